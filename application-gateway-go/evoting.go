@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -15,11 +17,19 @@ import (
 	"google.golang.org/grpc/credentials"
 )
 
+// The demo acts as the admin to seed the ledger, as a researcher to manage
+// polls and as a voter to cast a ballot, since each of these steps is
+// restricted to the matching evoting.role attribute. It expects a freshly
+// started network, as the seed poll can only be created and voted in once.
+const (
+	adminUser      = "Admin"
+	researcherUser = "Researcher1"
+	voterUser      = "User1"
+)
+
 const (
 	mspID        = "Org1MSP"
 	cryptoPath   = "../../../test-network/organizations/peerOrganizations/org1.example.com"
-	certPath     = cryptoPath + "/users/User1@org1.example.com/msp/signcerts/cert.pem"
-	keyPath      = cryptoPath + "/users/User1@org1.example.com/msp/keystore/"
 	tlsCertPath  = cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt"
 	peerEndpoint = "localhost:7051"
 	gatewayPeer  = "peer0.org1.example.com"
@@ -33,13 +43,51 @@ func main() {
 	clientConnection := newGrpcConnection()
 	defer clientConnection.Close()
 
-	id := newIdentity()
-	sign := newSign()
+	adminGw := newGateway(clientConnection, adminUser)
+	defer adminGw.Close()
+	researcherGw := newGateway(clientConnection, researcherUser)
+	defer researcherGw.Close()
+	voterGw := newGateway(clientConnection, voterUser)
+	defer voterGw.Close()
 
-	
+	chaincodeName := "basic"
+	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
+		chaincodeName = ccname
+	}
+
+	channelName := "mychannel"
+	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
+		channelName = cname
+	}
+
+	adminNetwork := adminGw.GetNetwork(channelName)
+	adminPollContract := adminNetwork.GetContractWithName(chaincodeName, "poll")
+	adminQuestionContract := adminNetwork.GetContractWithName(chaincodeName, "question")
+	researcherContract := researcherGw.GetNetwork(channelName).GetContractWithName(chaincodeName, "poll")
+	voteContract := voterGw.GetNetwork(channelName).GetContractWithName(chaincodeName, "vote")
+
+	// initialize the ledger as the admin, open the seed poll & display
+	initLedgerPoll(adminPollContract)
+	initLedgerQuestion(adminQuestionContract)
+	openPoll(adminPollContract)
+	getAllPolls(adminPollContract)
+
+	// cast a ballot as a voter without exposing its answers in the transaction
+	castVote(voteContract)
+
+	// showcase CRUD functions as a researcher
+	createPoll(researcherContract)
+	readPollByID(researcherContract)
+	updatePollByID(researcherContract)
+	readPollByID(researcherContract)
+	deletePollByID(researcherContract)
+}
+
+// Connect a gateway that signs as the given user of the organization.
+func newGateway(clientConnection *grpc.ClientConn, user string) *client.Gateway {
 	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
+		newIdentity(user),
+		client.WithSign(newSign(user)),
 		client.WithClientConnection(clientConnection),
 		// Default timeouts for different gRPC calls
 		client.WithEvaluateTimeout(5*time.Second),
@@ -50,32 +98,8 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer gw.Close()
 
-
-	chaincodeName := "basic"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
-	}
-
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
-	}
-
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
-
-	// initialize the ledger & display
-	initLedgerPoll(contract)
-	getAllPolls(contract)
-	
-	// showcase CRUD functions
-	createPoll(contract)
-	readPollByID(contract)
-	updatePollByID(contract)
-	readPollByID(contract)
-	deletePollByID(contract)
+	return gw
 }
 
 func newGrpcConnection() *grpc.ClientConn {
@@ -96,7 +120,8 @@ func newGrpcConnection() *grpc.ClientConn {
 	return connection
 }
 
-func newIdentity() *identity.X509Identity {
+func newIdentity(user string) *identity.X509Identity {
+	certPath := cryptoPath + "/users/" + user + "@org1.example.com/msp/signcerts/cert.pem"
 	certificate, err := loadCertificate(certPath)
 	if err != nil {
 		panic(err)
@@ -118,7 +143,8 @@ func loadCertificate(filename string) (*x509.Certificate, error) {
 	return identity.CertificateFromPEM(certificatePEM)
 }
 
-func newSign() identity.Sign {
+func newSign(user string) identity.Sign {
+	keyPath := cryptoPath + "/users/" + user + "@org1.example.com/msp/keystore/"
 	files, err := os.ReadDir(keyPath)
 	if err != nil {
 		panic(fmt.Errorf("failed to read private key directory: %w", err))
@@ -143,9 +169,31 @@ func newSign() identity.Sign {
 }
 
 func initLedgerPoll(contract *client.Contract) {
-	fmt.Printf("\n--> Submit Transaction: InitLedger, function creates the initial set of polls on the ledger \n")
+	fmt.Printf("\n--> Submit Transaction: InitLedgerPoll, function creates the initial set of polls on the ledger \n")
 
-	_, err := contract.SubmitTransaction("InitLedger")
+	_, err := contract.Submit("InitLedgerPoll", client.WithTransient(map[string][]byte{"salt": newSalt()}))
+	if err != nil {
+		panic(fmt.Errorf("failed to submit transaction: %w", err))
+	}
+
+	fmt.Printf("*** Transaction committed successfully\n")
+}
+
+func initLedgerQuestion(contract *client.Contract) {
+	fmt.Printf("\n--> Submit Transaction: InitLedgerQuestion, function adds the questions of the initial poll to the ledger \n")
+
+	_, err := contract.SubmitTransaction("InitLedgerQuestion")
+	if err != nil {
+		panic(fmt.Errorf("failed to submit transaction: %w", err))
+	}
+
+	fmt.Printf("*** Transaction committed successfully\n")
+}
+
+func openPoll(contract *client.Contract) {
+	fmt.Printf("\n--> Submit Transaction: OpenPoll, opens the initial poll for voting \n")
+
+	_, err := contract.SubmitTransaction("OpenPoll", "1")
 	if err != nil {
 		panic(fmt.Errorf("failed to submit transaction: %w", err))
 	}
@@ -166,9 +214,12 @@ func getAllPolls(contract *client.Contract) {
 }
 
 func createPoll(contract *client.Contract) {
-	fmt.Printf("\n--> Submit Transaction: CreatePoll, creates new poll with ID, Name, Researcher, Description and Status arguments \n")
+	fmt.Printf("\n--> Submit Transaction: CreatePoll, creates new poll with ID, Name, Researcher and Description arguments \n")
 
-	_, err := contract.SubmitTransaction("CreatePoll", "2", "Test", "Hsin", "Test Poll to showcase CRUD functions", "Ongoing")
+	_, err := contract.Submit("CreatePoll",
+		client.WithArguments("2", "Test", "Hsin", "Test Poll to showcase CRUD functions"),
+		client.WithTransient(map[string][]byte{"salt": newSalt()}),
+	)
 	if err != nil {
 		panic(fmt.Errorf("failed to submit transaction: %w", err))
 	}
@@ -190,9 +241,9 @@ func readPollByID(contract *client.Contract) {
 }
 
 func updatePollByID(contract *client.Contract) {
-	fmt.Printf("\n--> Submit Transaction: UpdatePoll, updates existing poll with ID, Name, Researcher, Description and Status arguments \n")
+	fmt.Printf("\n--> Submit Transaction: UpdatePoll, updates existing poll with ID, Name, Researcher and Description arguments \n")
 
-	_, err := contract.SubmitTransaction("UpdatePoll", "2", "Test CRUD", "Hsin", "Updated description", "Completed")
+	_, err := contract.SubmitTransaction("UpdatePoll", "2", "Test CRUD", "Hsin", "Updated description")
 	if err != nil {
 		panic(fmt.Errorf("failed to submit transaction: %w", err))
 	}
@@ -211,6 +262,55 @@ func deletePollByID(contract *client.Contract) {
 	fmt.Printf("*** Transaction committed successfully\n")
 }
 
+// Submit a ballot as transient data so its answers never appear in the block.
+func castVote(contract *client.Contract) {
+	fmt.Printf("\n--> Submit Transaction: CastVote, records a ballot for poll 1 passed in the transient data\n")
+
+	ballot := []byte(`{"Answers":[{"QuestionID":"1-1","Answer":"4"},{"QuestionID":"1-2","Answer":"3"},{"QuestionID":"1-3","Answer":"5"},{"QuestionID":"1-4","Answer":"2"},{"QuestionID":"1-5","Answer":"4"},{"QuestionID":"1-6","Answer":"3"}],"Age":"31","Gender":"Male","Occupation":"Engineer","Country":"Malaysia"}`)
+
+	// the nonce stays with the voter and is needed later to verify the receipt
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Errorf("failed to generate nonce: %w", err))
+	}
+	nonceHex := hex.EncodeToString(nonce)
+
+	receipt, commit, err := contract.SubmitAsync("CastVote",
+		client.WithArguments("1"),
+		client.WithTransient(map[string][]byte{"ballot": ballot, "nonce": []byte(nonceHex)}),
+	)
+	if err != nil {
+		panic(fmt.Errorf("failed to submit transaction: %w", err))
+	}
+
+	status, err := commit.Status()
+	if err != nil {
+		panic(fmt.Errorf("failed to get commit status: %w", err))
+	}
+	if !status.Successful {
+		panic(fmt.Errorf("transaction %s failed to commit with status code %d", status.TransactionID, int32(status.Code)))
+	}
+
+	fmt.Printf("*** Transaction committed successfully in block %d, receipt:%s\n", status.BlockNumber, formatJSON(receipt))
+
+	verifyResult, err := contract.EvaluateTransaction("VerifyReceipt", string(receipt), nonceHex)
+	if err != nil {
+		panic(fmt.Errorf("failed to evaluate transaction: %w", err))
+	}
+
+	fmt.Printf("*** Receipt status:%s\n", formatJSON(verifyResult))
+}
+
+// Generate the secret voter salt of a new poll, which is passed as transient
+// data and kept in the private data collection.
+func newSalt() []byte {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		panic(fmt.Errorf("failed to generate salt: %w", err))
+	}
+	return salt
+}
+
 func formatJSON(data []byte) string {
 	var prettyJSON bytes.Buffer
 	if err := json.Indent(&prettyJSON, data, "", "  "); err != nil {
@@ -7,70 +7,161 @@ import (
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// SmartContract provides functions for managing a answer.
-type SmartContract struct {
+// PaginatedAnswers describes one page of answers and the bookmark of the next page.
+type PaginatedAnswers struct {
+	Records      []*Answer `json:"records"`
+	Bookmark     string    `json:"bookmark"`
+	FetchedCount int32     `json:"fetchedCount"`
+}
+
+// AnswerContract provides functions for managing an answer.
+type AnswerContract struct {
 	contractapi.Contract
 }
 
-// Answer describes specified details of what makes up an answer.
+// Answer describes specified details of what makes up an answer. Answers are
+// stored in the ballot private data collection and are write-once: a ballot
+// is corrected by spoiling or replacing it as a whole, see SpoilBallot.
 type Answer struct {
-	ID 		        string    	`json:"ID"`
-	Answer      	string    	`json:"Answer"`
+	ID         string `json:"ID"`
+	QuestionID string `json:"QuestionID"`
+	VoteID     string `json:"VoteID"`
+	Answer     string `json:"Answer"`
+}
+
+// ReadAnswer returns the answer stored in the private data collection with given id.
+func (s *AnswerContract) ReadAnswer(ctx contractapi.TransactionContextInterface, id string) (*Answer, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	return readAnswer(ctx, id)
+}
+
+// AnswerExists returns true when answer with given ID exists in the private data collection
+func (s *AnswerContract) AnswerExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := answerKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	answerJSON, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from private data: %v", err)
+	}
+
+	return answerJSON != nil, nil
+}
+
+// GetAllAnswers returns all answers found in the private data collection.
+func (s *AnswerContract) GetAllAnswers(ctx contractapi.TransactionContextInterface) ([]*Answer, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	return getAllAnswers(ctx)
+}
+
+// GetAnswersByQuestion returns all answers given to the question with given id.
+func (s *AnswerContract) GetAnswersByQuestion(ctx contractapi.TransactionContextInterface, questionID string) ([]*Answer, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	return getQuestionAnswers(ctx, questionID)
 }
 
-// InitLedgerAnswer adds answers to the live testing answer into the ledger.
-func (s *SmartContract) InitLedgerAnswer(ctx contractapi.TransactionContextInterface) error {
-	answers := []Answer{
-			{ID: "1-1-1", Answer: "4"},
-			{ID: "1-2-1", Answer: "4"},
-			{ID: "1-3-1", Answer: "5"},
-			{ID: "1-4-1", Answer: "4"},
-			{ID: "1-5-1", Answer: "4"},
-			{ID: "1-6-1", Answer: "5"},
+// GetAnswersWithPagination returns one page of at most pageSize answers,
+// starting at the given bookmark. Pass an empty bookmark to fetch the first page.
+// Private data cannot be paged, so the public question~answer index is paged instead.
+func (s *AnswerContract) GetAnswersWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedAnswers, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(questionAnswerIndex, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	answers := []*Answer{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
 		}
-		
-	for _, answer := range answers {
-		answerJSON, err := json.Marshal(answer)
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if len(attributes) != 2 {
+			return nil, fmt.Errorf("malformed %s index key %q", questionAnswerIndex, queryResponse.Key)
 		}
 
-		err = ctx.GetStub().PutState(answer.ID, answerJSON)
+		answer, err := readAnswer(ctx, attributes[1])
 		if err != nil {
-			return fmt.Errorf("failed to put to world state. %v", err)
+			return nil, err
 		}
+		answers = append(answers, answer)
 	}
 
-	return nil
+	return &PaginatedAnswers{
+		Records:      answers,
+		Bookmark:     responseMetadata.Bookmark,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+	}, nil
 }
 
-// CreateAnswer issues a new answer to the world state with given details
-func (s *SmartContract) CreateAnswer(ctx contractapi.TransactionContextInterface, id string, answer string) error {
-	exists, err := s.AnswerExists(ctx, id)
+// GetAnswersByQuestionWithPagination returns one page of at most pageSize
+// answers given to the question with given id, starting at the given bookmark.
+func (s *AnswerContract) GetAnswersByQuestionWithPagination(ctx contractapi.TransactionContextInterface, questionID string, pageSize int32, bookmark string) (*PaginatedAnswers, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
 	if err != nil {
-		return err
-	}
-	if exists {
-		return fmt.Errorf("the answer %s already exists", id)
+		return nil, err
 	}
 
-	answer := Answer{
-		ID:            id,
-		Answer:        answer,
-	}
-	answerJSON, err := json.Marshal(answer)
+	ids, nextBookmark, fetchedCount, err := getIndexedIDsWithPagination(ctx, questionAnswerIndex, questionID, pageSize, bookmark)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	answers := []*Answer{}
+	for _, id := range ids {
+		answer, err := readAnswer(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, answer)
 	}
 
-	return ctx.GetStub().PutState(id, answerJSON)
+	return &PaginatedAnswers{
+		Records:      answers,
+		Bookmark:     nextBookmark,
+		FetchedCount: fetchedCount,
+	}, nil
 }
 
-// Readanswer returns the answer stored in the world state with given id.
-func (s *SmartContract) ReadAnswer(ctx contractapi.TransactionContextInterface, id string) (*answer, error) {
-	answerJSON, err := ctx.GetStub().GetState(id)
+// readAnswer returns the answer stored in the private data collection with given id.
+func readAnswer(ctx contractapi.TransactionContextInterface, id string) (*Answer, error) {
+	key, err := answerKey(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, err
+	}
+
+	answerJSON, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from private data: %v", err)
 	}
 	if answerJSON == nil {
 		return nil, fmt.Errorf("the answer %s does not exist", id)
@@ -85,56 +176,54 @@ func (s *SmartContract) ReadAnswer(ctx contractapi.TransactionContextInterface,
 	return &answer, nil
 }
 
-// UpdateAnswer updates an existing answer in the world state with provided parameters.
-func (s *SmartContract) UpdateAnswer(ctx contractapi.TransactionContextInterface, id string, answer string) error {
-	exists, err := s.AnswerExists(ctx, id)
+// putAnswer writes the given answer to the private data collection and indexes
+// it under its question. An answer, once written, is never overwritten.
+func putAnswer(ctx contractapi.TransactionContextInterface, answer *Answer) error {
+	answerJSON, err := json.Marshal(answer)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the answer %s does not exist", id)
-	}
 
-	// overwriting original answer with new answer
-	answer := Answer{
-		ID:             id,
-		Answer:           answer,
-	}
-	answerJSON, err := json.Marshal(answer)
+	key, err := answerKey(ctx, answer.ID)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, answerJSON)
-}
+	err = assertPrivateKeyUnused(ctx, key)
+	if err != nil {
+		return fmt.Errorf("the answer %s is already recorded: %v", answer.ID, err)
+	}
 
-// DeleteAnswer deletes an given answer from the world state.
-func (s *SmartContract) DeleteAnswer(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.AnswerExists(ctx, id)
+	err = ctx.GetStub().PutPrivateData(ballotCollection, key, answerJSON)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the answer %s does not exist", id)
-	}
 
-	return ctx.GetStub().DelState(id)
+	return putIndexEntry(ctx, questionAnswerIndex, answer.QuestionID, answer.ID)
 }
 
-// AnswerExists returns true when answer with given ID exists in world state
-func (s *SmartContract) AnswerExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	answerJSON, err := ctx.GetStub().GetState(id)
+// getQuestionAnswers returns all answers given to the question with given id.
+func getQuestionAnswers(ctx contractapi.TransactionContextInterface, questionID string) ([]*Answer, error) {
+	ids, err := getIndexedIDs(ctx, questionAnswerIndex, questionID)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, err
 	}
 
-	return answerJSON != nil, nil
-}
+	var answers []*Answer
+	for _, id := range ids {
+		answer, err := readAnswer(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, answer)
+	}
 
-// GetAllAnswers returns all answers found in the world state.
-func (s *SmartContract) GetAllAnswers(ctx contractapi.TransactionContextInterface) ([]*Answer, error) {
+	return answers, nil
+}
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+// getAllAnswers returns all answers found in the private data collection.
+func getAllAnswers(ctx contractapi.TransactionContextInterface) ([]*Answer, error) {
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(ballotCollection, answerObjectType, []string{})
 	if err != nil {
 		return nil, err
 	}
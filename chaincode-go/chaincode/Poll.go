@@ -1,49 +1,167 @@
 package chaincode
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// SmartContract provides functions for managing a poll.
-type SmartContract struct {
+// Lifecycle states of a poll. A poll moves strictly forward through
+// Draft -> Open -> Closed -> Tallied -> Archived.
+const (
+	PollStatusDraft    = "Draft"
+	PollStatusOpen     = "Open"
+	PollStatusClosed   = "Closed"
+	PollStatusTallied  = "Tallied"
+	PollStatusArchived = "Archived"
+)
+
+// PollStatusScheduled is never stored; it is the effective status of an Open
+// poll whose opening time has not been reached yet.
+const PollStatusScheduled = "Scheduled"
+
+// Voting modes of a poll. In direct mode ballots are recorded as they are
+// cast. In commit-reveal mode voters only submit a commitment to their ballot
+// while the poll is open and reveal it once the poll is closed, so no running
+// totals can be observed during voting. In homomorphic mode answers are
+// encrypted under the key of the poll's trustees and only their sum is ever
+// decrypted.
+const (
+	PollModeDirect       = "direct"
+	PollModeCommitReveal = "commit-reveal"
+	PollModeHomomorphic  = "homomorphic"
+)
+
+// pollTransitions lists the state each poll status is allowed to move to.
+var pollTransitions = map[string]string{
+	PollStatusDraft:   PollStatusOpen,
+	PollStatusOpen:    PollStatusClosed,
+	PollStatusClosed:  PollStatusTallied,
+	PollStatusTallied: PollStatusArchived,
+}
+
+// PaginatedPolls describes one page of polls and the bookmark of the next page.
+type PaginatedPolls struct {
+	Records      []*Poll `json:"records"`
+	Bookmark     string  `json:"bookmark"`
+	FetchedCount int32   `json:"fetchedCount"`
+}
+
+// PollContract provides functions for managing a poll.
+type PollContract struct {
 	contractapi.Contract
 }
 
-// Poll describes specified details of what makes up a poll.
+// Poll describes specified details of what makes up a poll. The poll is owned
+// by the client identity that created it, recorded as its MSP ID and
+// certificate subject; Researcher is only a display name.
 type Poll struct {
-	ID 		        string    	`json:"ID"`
-	Name          	string 		`json:"Name"`
-	Researcher      string    	`json:"Researcher"`
-	Description     string 		`json:"Description"`
-	Status          string      `json:"Status"`
+	ID          string `json:"ID"`
+	Name        string `json:"Name"`
+	Researcher  string `json:"Researcher"`
+	Description string `json:"Description"`
+	Status      string `json:"Status"`
+	OwnerMSP    string `json:"OwnerMSP"`
+	Owner       string `json:"Owner"`
+	OpensAt     string `json:"OpensAt,omitempty"`
+	ClosesAt    string `json:"ClosesAt,omitempty"`
+
+	// VoterAttribute optionally names the certificate attribute that
+	// identifies a voter instead of their certificate.
+	VoterAttribute string `json:"VoterAttribute,omitempty"`
+
+	// EligibilityRoot is the hex-encoded Merkle root of the identifiers of
+	// the voters allowed to take part; when empty anyone may vote.
+	EligibilityRoot string `json:"EligibilityRoot,omitempty"`
+
+	// TokenIssuerKey is the PEM-encoded RSA public key of the service issuing
+	// anonymous eligibility tokens. When set, the poll only accepts ballots
+	// carrying a token, which are not linked to the identity casting them.
+	TokenIssuerKey string `json:"TokenIssuerKey,omitempty"`
+
+	// AgeBands holds the ascending lower bound of each age band voters are
+	// grouped into; when empty the default bands are used.
+	AgeBands []int `json:"AgeBands,omitempty"`
+
+	// MinCellSize is the k-anonymity threshold of the poll's demographic
+	// results; when zero the default threshold is used.
+	MinCellSize int `json:"MinCellSize,omitempty"`
+
+	// Mode is the voting mode of the poll; when empty the poll is in direct mode.
+	Mode string `json:"Mode,omitempty"`
+
+	// RevealsUntil is the time, in RFC 3339 format, until which the ballots
+	// of a closed commit-reveal poll can be revealed. It is fixed while the
+	// poll is a Draft and the poll cannot be tallied before it has passed.
+	RevealsUntil string `json:"RevealsUntil,omitempty"`
+
+	// Trustees holds the hex-encoded public keys of the key holders of a
+	// homomorphic poll, whose sum is the key ballots are encrypted under.
+	Trustees []string `json:"Trustees,omitempty"`
+
+	// EffectiveStatus is computed on reads from Status, the schedule and the
+	// transaction timestamp. It is never written to the world state.
+	EffectiveStatus string `json:"EffectiveStatus,omitempty"`
 }
 
-// InitLedgerPoll adds the live testing poll into the ledger.
-func (s *SmartContract) InitLedgerPoll(ctx contractapi.TransactionContextInterface) error {
+// InitLedgerPoll adds the live testing poll into the ledger as a draft, so its
+// questions can be seeded with InitLedgerQuestion before it is opened. Like
+// CreatePoll, it takes the voter salt of the poll from the "salt" transient field.
+func (s *PollContract) InitLedgerPoll(ctx contractapi.TransactionContextInterface) error {
+	err := assertRole(ctx, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
 	polls := []Poll{
-			{ID: "1", Name: "Does blockchain increase participation in polls for academic research?", Researcher: "UTAR", Description: "Polling is used by sociologists for academic research. \nHowever, the participation rate has decreased over the years due to lack of privacy, ease of use & accessibility. \nFrom recent research, using blockchain technology addresses these aforementioned issues. \nThis survey gathers public opinion to test this hypothesis.", Status: "Ongoing"},
-		}
-		
+		{ID: "1", Name: "Does blockchain increase participation in polls for academic research?", Researcher: "UTAR", Description: "Polling is used by sociologists for academic research. \nHowever, the participation rate has decreased over the years due to lack of privacy, ease of use & accessibility. \nFrom recent research, using blockchain technology addresses these aforementioned issues. \nThis survey gathers public opinion to test this hypothesis.", Status: PollStatusDraft},
+	}
+
+	ownerMSP, owner, err := clientOwner(ctx)
+	if err != nil {
+		return err
+	}
+
 	for _, poll := range polls {
-		pollJSON, err := json.Marshal(poll)
+		exists, err := s.PollExists(ctx, poll.ID)
 		if err != nil {
 			return err
 		}
+		if exists {
+			return fmt.Errorf("the poll %s already exists", poll.ID)
+		}
 
-		err = ctx.GetStub().PutState(poll.ID, pollJSON)
+		poll.OwnerMSP = ownerMSP
+		poll.Owner = owner
+		err = putPoll(ctx, &poll)
 		if err != nil {
 			return fmt.Errorf("failed to put to world state. %v", err)
 		}
+
+		err = putPollSalt(ctx, poll.ID)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// CreatePoll issues a new poll to the world state with given details
-func (s *SmartContract) CreatePoll(ctx contractapi.TransactionContextInterface, id string, name string, researcher string, description string, status string) error {
+// CreatePoll issues a new poll to the world state with given details.
+// New polls always start in the Draft state. The secret voter salt of the
+// poll must be passed in the "salt" transient field; it is kept in the
+// private data collection, so the transaction must be endorsed by a
+// collection member.
+func (s *PollContract) CreatePoll(ctx contractapi.TransactionContextInterface, id string, name string, researcher string, description string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
 	exists, err := s.PollExists(ctx, id)
 	if err != nil {
 		return err
@@ -52,82 +170,524 @@ func (s *SmartContract) CreatePoll(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("the poll %s already exists", id)
 	}
 
+	ownerMSP, owner, err := clientOwner(ctx)
+	if err != nil {
+		return err
+	}
+
 	poll := Poll{
-		ID:            id,
-		Name:          name,
-		Researcher:    researcher,
-		Description:   description,
-		Status:        status,
+		ID:          id,
+		Name:        name,
+		Researcher:  researcher,
+		Description: description,
+		Status:      PollStatusDraft,
+		OwnerMSP:    ownerMSP,
+		Owner:       owner,
 	}
-	pollJSON, err := json.Marshal(poll)
+
+	err = putPoll(ctx, &poll)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, pollJSON)
+	err = putPollSalt(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return emitPollEvent(ctx, EventPollCreated, &poll)
 }
 
-// ReadPoll returns the poll stored in the world state with given id.
-func (s *SmartContract) ReadPoll(ctx contractapi.TransactionContextInterface, id string) (*Poll, error) {
-	pollJSON, err := ctx.GetStub().GetState(id)
+// ReadPoll returns the poll stored in the world state with given id, along with its effective status.
+func (s *PollContract) ReadPoll(ctx contractapi.TransactionContextInterface, id string) (*Poll, error) {
+	poll, err := readPoll(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if pollJSON == nil {
-		return nil, fmt.Errorf("the poll %s does not exist", id)
+		return nil, err
 	}
 
-	var poll Poll
-	err = json.Unmarshal(pollJSON, &poll)
+	now, err := txTime(ctx)
 	if err != nil {
 		return nil, err
 	}
+	poll.EffectiveStatus = effectivePollStatus(poll, now)
 
-	return &poll, nil
+	return poll, nil
 }
 
-// UpdatePoll updates an existing poll in the world state with provided parameters.
-func (s *SmartContract) UpdatePoll(ctx contractapi.TransactionContextInterface, id string, name string, researcher string, description string, status string) error {
-	exists, err := s.PollExists(ctx, id)
+// UpdatePoll updates the details of an existing poll in the world state.
+// The status is left untouched and may only be changed through the lifecycle
+// transactions; a poll can only be edited by its owner while it is still a Draft.
+func (s *PollContract) UpdatePoll(ctx contractapi.TransactionContextInterface, id string, name string, researcher string, description string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the poll %s does not exist", id)
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
 	}
 
-	// overwriting original poll with new poll
-	poll := Poll{
-		ID:             id,
-		Name:           name,
-		Researcher:     researcher,
-		Description:    description,
-		Status: 		status,
+	poll.Name = name
+	poll.Researcher = researcher
+	poll.Description = description
+
+	return putPoll(ctx, poll)
+}
+
+// DeletePoll deletes an given poll from the world state, along with its
+// questions, and releases its token issuer key. Only the owner can delete a
+// poll, and only while it is still a Draft.
+func (s *PollContract) DeletePoll(ctx contractapi.TransactionContextInterface, id string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be deleted", id, poll.Status)
+	}
+
+	questions, err := getPollQuestions(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, question := range questions {
+		err = deleteQuestion(ctx, question)
+		if err != nil {
+			return err
+		}
+	}
+
+	if poll.TokenIssuerKey != "" {
+		err = unbindTokenIssuerKey(ctx, poll.TokenIssuerKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := pollKey(ctx, id)
+	if err != nil {
+		return err
 	}
-	pollJSON, err := json.Marshal(poll)
+
+	err = ctx.GetStub().DelState(key)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, pollJSON)
+	return recordSubmitter(ctx, pollObjectType, id)
 }
 
-// DeletePoll deletes an given asset from the world state.
-func (s *SmartContract) DeletePoll(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.PollExists(ctx, id)
+// SchedulePoll sets the times, in RFC 3339 format, between which an Open poll
+// accepts votes. Either time may be left empty. The schedule can only be
+// changed while the poll is still a Draft.
+func (s *PollContract) SchedulePoll(ctx contractapi.TransactionContextInterface, id string, opensAt string, closesAt string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be rescheduled", id, poll.Status)
+	}
+
+	var opens, closes time.Time
+	if opensAt != "" {
+		opens, err = time.Parse(time.RFC3339, opensAt)
+		if err != nil {
+			return fmt.Errorf("invalid opening time %q: %v", opensAt, err)
+		}
+	}
+	if closesAt != "" {
+		closes, err = time.Parse(time.RFC3339, closesAt)
+		if err != nil {
+			return fmt.Errorf("invalid closing time %q: %v", closesAt, err)
+		}
+	}
+	if opensAt != "" && closesAt != "" && !closes.After(opens) {
+		return fmt.Errorf("the poll %s must close after it opens", id)
+	}
+	if reveals, err := time.Parse(time.RFC3339, poll.RevealsUntil); err == nil && closesAt != "" && !reveals.After(closes) {
+		return fmt.Errorf("the poll %s must close before its reveal deadline %s", id, poll.RevealsUntil)
+	}
+
+	poll.OpensAt = opensAt
+	poll.ClosesAt = closesAt
+
+	return putPoll(ctx, poll)
+}
+
+// SetRevealDeadline sets the time, in RFC 3339 format, until which the
+// ballots of a commit-reveal poll can be revealed once it is closed. It must
+// be set before a commit-reveal poll is opened and can only be changed while
+// the poll is still a Draft, so the owner cannot end the reveal window early
+// once the first reveals are known.
+func (s *PollContract) SetRevealDeadline(ctx contractapi.TransactionContextInterface, id string, revealsUntil string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be rescheduled", id, poll.Status)
+	}
+
+	reveals, err := time.Parse(time.RFC3339, revealsUntil)
+	if err != nil {
+		return fmt.Errorf("invalid reveal deadline %q: %v", revealsUntil, err)
+	}
+	if closes, err := time.Parse(time.RFC3339, poll.ClosesAt); err == nil && !reveals.After(closes) {
+		return fmt.Errorf("the reveal deadline of poll %s must be after it closes at %s", id, poll.ClosesAt)
+	}
+
+	poll.RevealsUntil = revealsUntil
+
+	return putPoll(ctx, poll)
+}
+
+// SetVoterAttribute sets the certificate attribute used to identify voters of
+// the poll when enforcing one vote per voter. An empty attribute identifies
+// voters by their MSP ID and certificate. It can only be changed while the
+// poll is still a Draft.
+func (s *PollContract) SetVoterAttribute(ctx contractapi.TransactionContextInterface, id string, attribute string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+
+	poll.VoterAttribute = attribute
+
+	return putPoll(ctx, poll)
+}
+
+// SetEligibilityRoot restricts the poll to the voters whose identifiers are
+// in the Merkle tree with the given hex-encoded root. The eligibility list
+// itself stays off-chain; voters prove their inclusion when they vote. An
+// empty root opens the poll to every voter. Polls with a token issuer check
+// eligibility when tokens are issued and cannot also have a root. It can only
+// be changed while the poll is still a Draft.
+func (s *PollContract) SetEligibilityRoot(ctx contractapi.TransactionContextInterface, id string, root string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+	if root != "" && poll.TokenIssuerKey != "" {
+		return fmt.Errorf("the poll %s has a token issuer, which checks eligibility when issuing tokens", id)
+	}
+	if root != "" {
+		decoded, err := hex.DecodeString(root)
+		if err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("the eligibility root must be a hex-encoded SHA-256 hash")
+		}
+		root = hex.EncodeToString(decoded)
+	}
+
+	poll.EligibilityRoot = root
+
+	return putPoll(ctx, poll)
+}
+
+// SetTokenIssuerKey makes the poll accept only anonymous ballots carrying an
+// eligibility token blind-signed by the issuer with the given PEM-encoded RSA
+// public key, see CastAnonymousVote. Every poll needs its own issuer key, so a
+// key already set on another poll is refused. Anonymous ballots carry no
+// eligibility proof, so a poll with an eligibility root cannot have a token
+// issuer; the issuer checks eligibility instead. An empty key restores
+// identified voting. It can only be changed while the poll is still a Draft.
+func (s *PollContract) SetTokenIssuerKey(ctx contractapi.TransactionContextInterface, id string, publicKeyPEM string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+	if publicKeyPEM != "" && poll.EligibilityRoot != "" {
+		return fmt.Errorf("the poll %s has an eligibility root, which anonymous ballots cannot be checked against", id)
+	}
+	if poll.TokenIssuerKey != "" {
+		err = unbindTokenIssuerKey(ctx, poll.TokenIssuerKey)
+		if err != nil {
+			return err
+		}
+	}
+	if publicKeyPEM != "" {
+		key, err := parseTokenIssuerKey(publicKeyPEM)
+		if err != nil {
+			return err
+		}
+
+		err = bindTokenIssuerKey(ctx, id, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	poll.TokenIssuerKey = publicKeyPEM
+
+	return putPoll(ctx, poll)
+}
+
+// SetAgeBands sets the ascending lower bounds of the age bands the poll's
+// voters are grouped into, e.g. [18,30,50] for under 18, 18-29, 30-49 and 50+.
+// An empty list restores the default bands. It can only be changed while the
+// poll is still a Draft.
+func (s *PollContract) SetAgeBands(ctx contractapi.TransactionContextInterface, id string, bands []int) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+	for i, bound := range bands {
+		if bound <= 0 || (i > 0 && bound <= bands[i-1]) {
+			return fmt.Errorf("the age bands of poll %s must be positive and ascending", id)
+		}
+	}
+
+	poll.AgeBands = bands
+
+	return putPoll(ctx, poll)
+}
+
+// SetMinCellSize sets the k-anonymity threshold of the poll: demographic
+// results never publish a group or count describing fewer than k voters. It
+// can only be changed while the poll is still a Draft.
+func (s *PollContract) SetMinCellSize(ctx contractapi.TransactionContextInterface, id string, k int) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the poll %s does not exist", id)
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+	if k < 1 {
+		return fmt.Errorf("the minimum cell size of poll %s must be at least 1", id)
 	}
 
-	return ctx.GetStub().DelState(id)
+	poll.MinCellSize = k
+
+	return putPoll(ctx, poll)
+}
+
+// SetPollMode sets the voting mode of a Draft poll to PollModeDirect,
+// PollModeCommitReveal or PollModeHomomorphic. Only the owner of the poll can
+// change its mode.
+func (s *PollContract) SetPollMode(ctx contractapi.TransactionContextInterface, id string, mode string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+	if mode != PollModeDirect && mode != PollModeCommitReveal && mode != PollModeHomomorphic {
+		return fmt.Errorf("unknown poll mode %q", mode)
+	}
+
+	poll.Mode = mode
+
+	return putPoll(ctx, poll)
+}
+
+// SetPollTrustees sets the key holders of a Draft homomorphic poll. Each
+// trustee must prove knowledge of their private key, so that no trustee can
+// pick a key that cancels out the others'. Only the owner of the poll can set
+// its trustees.
+func (s *PollContract) SetPollTrustees(ctx contractapi.TransactionContextInterface, id string, trustees []Trustee) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+	if len(trustees) == 0 {
+		return fmt.Errorf("the poll %s needs at least one trustee", id)
+	}
+
+	keys := []string{}
+	seen := make(map[string]bool)
+	g := generator()
+	for _, trustee := range trustees {
+		y, err := decodePoint(trustee.PublicKey)
+		if err != nil {
+			return err
+		}
+
+		key := y.encode()
+		if seen[key] {
+			return fmt.Errorf("the trustee %s is listed more than once", key)
+		}
+		if !verifyDLEQ(id+"|trustee", g, y, g, y, trustee.Proof) {
+			return fmt.Errorf("invalid proof of knowledge for trustee %s", key)
+		}
+
+		seen[key] = true
+		keys = append(keys, key)
+	}
+
+	poll.Trustees = keys
+
+	_, err = pollPublicKey(poll)
+	if err != nil {
+		return err
+	}
+
+	return putPoll(ctx, poll)
+}
+
+// TransferPollOwnership hands the poll over to the identity with the given MSP
+// ID and certificate subject. Only the current owner or an admin can transfer a poll.
+func (s *PollContract) TransferPollOwnership(ctx contractapi.TransactionContextInterface, id string, newOwnerMSP string, newOwner string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if newOwnerMSP == "" || newOwner == "" {
+		return fmt.Errorf("the new owner of poll %s must have an MSP ID and subject", id)
+	}
+
+	poll.OwnerMSP = newOwnerMSP
+	poll.Owner = newOwner
+
+	return putPoll(ctx, poll)
+}
+
+// OpenPoll moves a Draft poll to Open so that it starts accepting votes.
+func (s *PollContract) OpenPoll(ctx contractapi.TransactionContextInterface, id string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if pollMode(poll) == PollModeHomomorphic {
+		err = checkPollEncryptable(ctx, poll)
+		if err != nil {
+			return err
+		}
+	}
+	if pollMode(poll) == PollModeCommitReveal && poll.RevealsUntil == "" {
+		return fmt.Errorf("the %s poll %s has no reveal deadline", PollModeCommitReveal, id)
+	}
+
+	return transitionPoll(ctx, id, PollStatusOpen, EventPollOpened)
+}
+
+// ClosePoll moves an Open poll to Closed so that it stops accepting votes.
+func (s *PollContract) ClosePoll(ctx contractapi.TransactionContextInterface, id string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return transitionPoll(ctx, id, PollStatusClosed, EventPollClosed)
+}
+
+// PublishResults moves a Closed poll to Tallied, making its stored result
+// public. The poll must have been tallied with TallyPoll first.
+func (s *PollContract) PublishResults(ctx contractapi.TransactionContextInterface, id string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	result, err := readResult(ctx, id)
+	if err != nil {
+		return err
+	}
+	if result.AwaitingDecryption {
+		return fmt.Errorf("the result of poll %s has not been decrypted by all of its trustees", id)
+	}
+
+	return transitionPoll(ctx, id, PollStatusTallied, EventResultsPublished)
+}
+
+// ArchivePoll moves a Tallied poll to Archived.
+func (s *PollContract) ArchivePoll(ctx contractapi.TransactionContextInterface, id string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return transitionPoll(ctx, id, PollStatusArchived, "")
 }
 
 // PollExists returns true when poll with given ID exists in world state
-func (s *SmartContract) PollExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	pollJSON, err := ctx.GetStub().GetState(id)
+func (s *PollContract) PollExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	key, err := pollKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	pollJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return false, fmt.Errorf("failed to read from world state: %v", err)
 	}
@@ -136,14 +696,19 @@ func (s *SmartContract) PollExists(ctx contractapi.TransactionContextInterface,
 }
 
 // GetAllPolls returns all polls found in the world state.
-func (s *SmartContract) GetAllPolls(ctx contractapi.TransactionContextInterface) ([]*Poll, error) {
+func (s *PollContract) GetAllPolls(ctx contractapi.TransactionContextInterface) ([]*Poll, error) {
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pollObjectType, []string{})
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var polls []*Poll
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
@@ -156,8 +721,248 @@ func (s *SmartContract) GetAllPolls(ctx contractapi.TransactionContextInterface)
 		if err != nil {
 			return nil, err
 		}
+		poll.EffectiveStatus = effectivePollStatus(&poll, now)
 		polls = append(polls, &poll)
 	}
 
 	return polls, nil
 }
+
+// GetPollsWithPagination returns one page of at most pageSize polls, starting
+// at the given bookmark. Pass an empty bookmark to fetch the first page.
+func (s *PollContract) GetPollsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedPolls, error) {
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(pollObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	polls := []*Poll{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var poll Poll
+		err = json.Unmarshal(queryResponse.Value, &poll)
+		if err != nil {
+			return nil, err
+		}
+		poll.EffectiveStatus = effectivePollStatus(&poll, now)
+		polls = append(polls, &poll)
+	}
+
+	return &PaginatedPolls{
+		Records:      polls,
+		Bookmark:     responseMetadata.Bookmark,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+	}, nil
+}
+
+// readPoll returns the poll stored in the world state with given id.
+func readPoll(ctx contractapi.TransactionContextInterface, id string) (*Poll, error) {
+	key, err := pollKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pollJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if pollJSON == nil {
+		return nil, fmt.Errorf("the poll %s does not exist", id)
+	}
+
+	var poll Poll
+	err = json.Unmarshal(pollJSON, &poll)
+	if err != nil {
+		return nil, err
+	}
+
+	return &poll, nil
+}
+
+// putPoll writes the given poll to the world state and records who wrote it.
+func putPoll(ctx contractapi.TransactionContextInterface, poll *Poll) error {
+	stored := *poll
+	stored.EffectiveStatus = ""
+
+	pollJSON, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	key, err := pollKey(ctx, poll.ID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, pollJSON)
+	if err != nil {
+		return err
+	}
+
+	return recordSubmitter(ctx, pollObjectType, poll.ID)
+}
+
+// transitionPoll moves the poll with given id to the given status, rejecting
+// any transition that is not allowed by the poll lifecycle or that is not
+// requested by the poll's owner. Unless event is empty, the chaincode event
+// with that name is emitted.
+func transitionPoll(ctx contractapi.TransactionContextInterface, id string, status string, event string) error {
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	// An Open poll whose closing time has passed is treated as Closed, so its
+	// results can be published without an explicit ClosePoll.
+	from := poll.Status
+	if from == PollStatusOpen && status != PollStatusClosed && effectivePollStatus(poll, now) == PollStatusClosed {
+		from = PollStatusClosed
+	}
+	if pollTransitions[from] != status {
+		return fmt.Errorf("the poll %s cannot move from %s to %s", id, from, status)
+	}
+
+	poll.Status = status
+
+	err = putPoll(ctx, poll)
+	if err != nil {
+		return err
+	}
+	if event == "" {
+		return nil
+	}
+
+	return emitPollEvent(ctx, event, poll)
+}
+
+// checkPollAcceptingVotes returns an error unless the given poll is Open and
+// the transaction timestamp falls within its schedule.
+func checkPollAcceptingVotes(ctx contractapi.TransactionContextInterface, poll *Poll) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := effectivePollStatus(poll, now)
+	if status != PollStatusOpen {
+		return fmt.Errorf("the poll %s is %s and is not accepting votes", poll.ID, status)
+	}
+
+	return nil
+}
+
+// checkPollRevealingBallots returns an error unless the given commit-reveal
+// poll is Closed, taking its schedule into account, and its reveal deadline
+// has not passed.
+func checkPollRevealingBallots(ctx contractapi.TransactionContextInterface, poll *Poll) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := effectivePollStatus(poll, now)
+	if status != PollStatusClosed {
+		return fmt.Errorf("the poll %s is %s and is not accepting reveals", poll.ID, status)
+	}
+	if revealsClosed(poll, now) {
+		return fmt.Errorf("the reveal deadline %s of poll %s has passed", poll.RevealsUntil, poll.ID)
+	}
+
+	return nil
+}
+
+// revealsClosed reports whether the reveal deadline of the given poll has
+// passed at the given time. A poll without a valid deadline, which OpenPoll
+// does not let a commit-reveal poll be opened without, accepts no reveals.
+func revealsClosed(poll *Poll, now time.Time) bool {
+	reveals, err := time.Parse(time.RFC3339, poll.RevealsUntil)
+	return err != nil || !now.Before(reveals)
+}
+
+// pollMode returns the voting mode of the given poll.
+func pollMode(poll *Poll) string {
+	if poll.Mode == "" {
+		return PollModeDirect
+	}
+	return poll.Mode
+}
+
+// effectivePollStatus returns the status of the poll at the given time,
+// taking its opening and closing times into account. Malformed times are
+// ignored since SchedulePoll only ever stores valid ones.
+func effectivePollStatus(poll *Poll, now time.Time) string {
+	if poll.Status != PollStatusOpen {
+		return poll.Status
+	}
+	if opens, err := time.Parse(time.RFC3339, poll.OpensAt); err == nil && now.Before(opens) {
+		return PollStatusScheduled
+	}
+	if closes, err := time.Parse(time.RFC3339, poll.ClosesAt); err == nil && !now.Before(closes) {
+		return PollStatusClosed
+	}
+
+	return PollStatusOpen
+}
+
+// txTime returns the timestamp of the current transaction, which is the same on every endorser.
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	return timestamp.AsTime(), nil
+}
+
+// readOwnedPoll returns the poll with given id, or an error unless the
+// submitting client owns it or is an admin.
+func readOwnedPoll(ctx contractapi.TransactionContextInterface, id string) (*Poll, error) {
+	poll, err := readPoll(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if assertRole(ctx, RoleAdmin) == nil {
+		return poll, nil
+	}
+
+	ownerMSP, owner, err := clientOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ownerMSP != poll.OwnerMSP || owner != poll.Owner {
+		return nil, fmt.Errorf("the client identity does not own poll %s", id)
+	}
+
+	return poll, nil
+}
+
+// assertPollEditable returns an error unless the poll with given id is still
+// a Draft and the submitting client owns it.
+func assertPollEditable(ctx contractapi.TransactionContextInterface, id string) error {
+	poll, err := readOwnedPoll(ctx, id)
+	if err != nil {
+		return err
+	}
+	if poll.Status != PollStatusDraft {
+		return fmt.Errorf("the poll %s is %s and can no longer be edited", id, poll.Status)
+	}
+
+	return nil
+}
@@ -3,39 +3,69 @@ package chaincode
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// SmartContract provides functions for managing a question.
-type SmartContract struct {
+// QuestionContract provides functions for managing a question.
+type QuestionContract struct {
 	contractapi.Contract
 }
 
+// Types of question a poll can ask. The type decides which answers are accepted:
+//   - single: exactly one of Options
+//   - multiple: a JSON array of distinct Options, e.g. ["Email","Phone"]
+//   - likert: a whole number on the scale Min..Max, e.g. 1..5
+//   - numeric: any number between Min and Max
+//   - text: any non-empty free text
+const (
+	QuestionTypeSingleChoice   = "single"
+	QuestionTypeMultipleChoice = "multiple"
+	QuestionTypeLikert         = "likert"
+	QuestionTypeNumeric        = "numeric"
+	QuestionTypeText           = "text"
+)
+
 // Question describes specified details of what makes up a question.
 type Question struct {
-	ID 	      	    string    	`json:"ID"`
-	Question      	string    	`json:"Question"`
+	ID       string   `json:"ID"`
+	PollID   string   `json:"PollID"`
+	Question string   `json:"Question"`
+	Type     string   `json:"Type"`
+	Options  []string `json:"Options,omitempty"`
+	Min      int      `json:"Min,omitempty"`
+	Max      int      `json:"Max,omitempty"`
+	Required bool     `json:"Required"`
+	Order    int      `json:"Order"`
 }
 
-// InitLedgerQuestion adds the live testing poll questions into the ledger.
-func (s *SmartContract) InitLedgerQuestion(ctx contractapi.TransactionContextInterface) error {
+// InitLedgerQuestion adds the live testing poll questions into the ledger. The
+// poll must still be a draft.
+func (s *QuestionContract) InitLedgerQuestion(ctx contractapi.TransactionContextInterface) error {
+	err := assertRole(ctx, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
 	questions := []Question{
-			{pollID: "1-1", Question: "How likely are you to participate in polling research?"},
-			{pollID: "1-2", Question: "Rate the standard of privacy compared to other polling methods."},
-			{pollID: "1-3", Question: "Rate the ease of use compared to other polling methods."},
-			{pollID: "1-4", Question: "Rate the accessibilty compared to other polling methods."},
-			{pollID: "1-5", Question: "Do you prefer to use this blockchain app over other polling methods?"},
-			{pollID: "1-6", Question: "Does this application increase the likelyhood of you participating in polling research?"},
-		}
-		
-	for _, question := range questions {
-		pollJSON, err := json.Marshal(question)
-		if err != nil {
-			return err
-		}
+		{ID: "1-1", PollID: "1", Type: QuestionTypeLikert, Min: 1, Max: 5, Required: true, Order: 1, Question: "How likely are you to participate in polling research?"},
+		{ID: "1-2", PollID: "1", Type: QuestionTypeLikert, Min: 1, Max: 5, Required: true, Order: 2, Question: "Rate the standard of privacy compared to other polling methods."},
+		{ID: "1-3", PollID: "1", Type: QuestionTypeLikert, Min: 1, Max: 5, Required: true, Order: 3, Question: "Rate the ease of use compared to other polling methods."},
+		{ID: "1-4", PollID: "1", Type: QuestionTypeLikert, Min: 1, Max: 5, Required: true, Order: 4, Question: "Rate the accessibilty compared to other polling methods."},
+		{ID: "1-5", PollID: "1", Type: QuestionTypeLikert, Min: 1, Max: 5, Required: true, Order: 5, Question: "Do you prefer to use this blockchain app over other polling methods?"},
+		{ID: "1-6", PollID: "1", Type: QuestionTypeLikert, Min: 1, Max: 5, Required: true, Order: 6, Question: "Does this application increase the likelyhood of you participating in polling research?"},
+	}
 
-		err = ctx.GetStub().PutState(question.ID, questionJSON)
+	err = assertPollEditable(ctx, "1")
+	if err != nil {
+		return err
+	}
+
+	for _, question := range questions {
+		err := putQuestion(ctx, &question)
 		if err != nil {
 			return fmt.Errorf("failed to put to world state. %v", err)
 		}
@@ -44,8 +74,16 @@ func (s *SmartContract) InitLedgerQuestion(ctx contractapi.TransactionContextInt
 	return nil
 }
 
-// CreateQuestion issues a new question to the world state with given details
-func (s *SmartContract) CreateQuestion(ctx contractapi.TransactionContextInterface, id string, question string) error {
+// CreateQuestion issues a new question for the given poll to the world state.
+// Options lists the choices of single and multiple choice questions, while
+// min and max bound likert and numeric answers. Questions can only be added
+// by the poll's owner while it is still a Draft.
+func (s *QuestionContract) CreateQuestion(ctx contractapi.TransactionContextInterface, id string, pollID string, text string, questionType string, options []string, min int, max int, required bool, order int) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
 	exists, err := s.QuestionExists(ctx, id)
 	if err != nil {
 		return err
@@ -54,76 +92,102 @@ func (s *SmartContract) CreateQuestion(ctx contractapi.TransactionContextInterfa
 		return fmt.Errorf("the question %s already exists", id)
 	}
 
+	err = assertPollEditable(ctx, pollID)
+	if err != nil {
+		return err
+	}
+
 	question := Question{
-		ID:        	    id,
-		Question:       question,
+		ID:       id,
+		PollID:   pollID,
+		Question: text,
+		Type:     questionType,
+		Options:  options,
+		Min:      min,
+		Max:      max,
+		Required: required,
+		Order:    order,
 	}
-	questionJSON, err := json.Marshal(question)
+	err = validateQuestion(&question)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(pollID, pollJSON)
+	return putQuestion(ctx, &question)
 }
 
 // ReadQuestion returns the question stored in the world state with given id.
-func (s *SmartContract) ReadQuestion(ctx contractapi.TransactionContextInterface, id string) (*Poll, error) {
-	questionJSON, err := ctx.GetStub().GetState(id)
+func (s *QuestionContract) ReadQuestion(ctx contractapi.TransactionContextInterface, id string) (*Question, error) {
+	return readQuestion(ctx, id)
+}
+
+// UpdateQuestion updates an existing question in the world state with provided parameters.
+// Questions can only be edited by the poll's owner while it is still a Draft.
+func (s *QuestionContract) UpdateQuestion(ctx contractapi.TransactionContextInterface, id string, text string, questionType string, options []string, min int, max int, required bool, order int) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if questionJSON == nil {
-		return nil, fmt.Errorf("the question %s does not exist", id)
+		return err
 	}
 
-	var question Question
-	err = json.Unmarshal(questionJSON, &question)
+	question, err := readQuestion(ctx, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &question, nil
-}
-
-// UpdateQuestion updates an existing question in the world state with provided parameters.
-func (s *SmartContract) UpdateQuestion(ctx contractapi.TransactionContextInterface, id string, question string) error {
-	exists, err := s.QuestionExists(ctx, id)
+	err = assertPollEditable(ctx, question.PollID)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the question %s does not exist", id)
-	}
 
-	// overwriting original question with new question
-	question := Question{
-		ID:             id,
-		Question:       question,
-	}
-	questionJSON, err := json.Marshal(question)
+	question.Question = text
+	question.Type = questionType
+	question.Options = options
+	question.Min = min
+	question.Max = max
+	question.Required = required
+	question.Order = order
+	err = validateQuestion(question)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, questionJSON)
+	return putQuestion(ctx, question)
 }
 
 // DeleteQuestion deletes an given question from the world state.
-func (s *SmartContract) DeleteQuestion(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.PollExists(ctx, id)
+// Questions can only be deleted by the poll's owner while it is still a Draft.
+func (s *QuestionContract) DeleteQuestion(ctx contractapi.TransactionContextInterface, id string) error {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the question %s does not exist", id)
+
+	question, err := readQuestion(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = assertPollEditable(ctx, question.PollID)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(id)
+	return deleteQuestion(ctx, question)
+}
+
+// GetQuestionsByPoll returns the questions of the given poll, in order.
+func (s *QuestionContract) GetQuestionsByPoll(ctx contractapi.TransactionContextInterface, pollID string) ([]*Question, error) {
+	return getPollQuestions(ctx, pollID)
 }
 
 // QuestionExists returns true when question with given ID exists in world state
-func (s *SmartContract) QuestionExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	questionJSON, err := ctx.GetStub().GetState(id)
+func (s *QuestionContract) QuestionExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	key, err := questionKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	questionJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return false, fmt.Errorf("failed to read from world state: %v", err)
 	}
@@ -132,28 +196,213 @@ func (s *SmartContract) QuestionExists(ctx contractapi.TransactionContextInterfa
 }
 
 // GetAllQuestions returns all questions found in the world state.
-func (s *SmartContract) GetAllQuestions(ctx contractapi.TransactionContextInterface) ([]*Poll, error) {
+func (s *QuestionContract) GetAllQuestions(ctx contractapi.TransactionContextInterface) ([]*Question, error) {
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(questionObjectType, []string{})
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	var questions []*Questions
+	var questions []*Question
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
 
-		var question Questions
+		var question Question
 		err = json.Unmarshal(queryResponse.Value, &question)
 		if err != nil {
 			return nil, err
 		}
-		questions = append(questions, &questions)
+		questions = append(questions, &question)
+	}
+
+	return questions, nil
+}
+
+// readQuestion returns the question stored in the world state with given id.
+func readQuestion(ctx contractapi.TransactionContextInterface, id string) (*Question, error) {
+	key, err := questionKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	questionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if questionJSON == nil {
+		return nil, fmt.Errorf("the question %s does not exist", id)
+	}
+
+	var question Question
+	err = json.Unmarshal(questionJSON, &question)
+	if err != nil {
+		return nil, err
+	}
+
+	return &question, nil
+}
+
+// putQuestion writes the given question to the world state and records who wrote it.
+func putQuestion(ctx contractapi.TransactionContextInterface, question *Question) error {
+	questionJSON, err := json.Marshal(question)
+	if err != nil {
+		return err
+	}
+
+	key, err := questionKey(ctx, question.ID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, questionJSON)
+	if err != nil {
+		return err
+	}
+
+	err = recordSubmitter(ctx, questionObjectType, question.ID)
+	if err != nil {
+		return err
+	}
+
+	return putIndexEntry(ctx, pollQuestionIndex, question.PollID, question.ID)
+}
+
+// deleteQuestion deletes the given question and its entry in the poll's
+// question index.
+func deleteQuestion(ctx contractapi.TransactionContextInterface, question *Question) error {
+	key, err := questionKey(ctx, question.ID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return err
+	}
+
+	err = recordSubmitter(ctx, questionObjectType, question.ID)
+	if err != nil {
+		return err
+	}
+
+	return deleteIndexEntry(ctx, pollQuestionIndex, question.PollID, question.ID)
+}
+
+// getPollQuestions returns all questions belonging to the poll with given id, in order.
+func getPollQuestions(ctx contractapi.TransactionContextInterface, pollID string) ([]*Question, error) {
+	ids, err := getIndexedIDs(ctx, pollQuestionIndex, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []*Question
+	for _, id := range ids {
+		question, err := readQuestion(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
 	}
 
+	sort.SliceStable(questions, func(i, j int) bool {
+		return questions[i].Order < questions[j].Order
+	})
+
 	return questions, nil
 }
+
+// validateQuestion returns an error unless the question's type, options and
+// bounds make up a consistent definition.
+func validateQuestion(question *Question) error {
+	switch question.Type {
+	case QuestionTypeSingleChoice, QuestionTypeMultipleChoice:
+		if len(question.Options) < 2 {
+			return fmt.Errorf("the %s choice question %s needs at least two options", question.Type, question.ID)
+		}
+		seen := make(map[string]bool)
+		for _, option := range question.Options {
+			if option == "" || seen[option] {
+				return fmt.Errorf("the question %s has an empty or duplicate option %q", question.ID, option)
+			}
+			seen[option] = true
+		}
+	case QuestionTypeLikert:
+		if len(question.Options) != 0 || question.Min >= question.Max {
+			return fmt.Errorf("the likert question %s needs a scale with Min below Max and no options", question.ID)
+		}
+	case QuestionTypeNumeric:
+		if len(question.Options) != 0 || question.Min > question.Max {
+			return fmt.Errorf("the numeric question %s needs a range with Min not above Max and no options", question.ID)
+		}
+	case QuestionTypeText:
+		if len(question.Options) != 0 {
+			return fmt.Errorf("the text question %s cannot have options", question.ID)
+		}
+	default:
+		return fmt.Errorf("the question %s has unknown type %q", question.ID, question.Type)
+	}
+
+	return nil
+}
+
+// answerValues validates an answer against the question's definition and
+// returns the individual values it selects, which for a multiple choice
+// question may be several options. Likert and numeric answers are returned in
+// canonical form, so that e.g. "03" and "+3" are counted together with "3".
+func answerValues(question *Question, value string) ([]string, error) {
+	switch question.Type {
+	case QuestionTypeSingleChoice:
+		if !containsString(question.Options, value) {
+			return nil, fmt.Errorf("the answer %q is not an option of question %s", value, question.ID)
+		}
+		return []string{value}, nil
+	case QuestionTypeMultipleChoice:
+		var selected []string
+		err := json.Unmarshal([]byte(value), &selected)
+		if err != nil || len(selected) == 0 {
+			return nil, fmt.Errorf("the answer to question %s must be a non-empty JSON array of options", question.ID)
+		}
+		seen := make(map[string]bool)
+		for _, option := range selected {
+			if !containsString(question.Options, option) || seen[option] {
+				return nil, fmt.Errorf("the answer %q is not a distinct option of question %s", option, question.ID)
+			}
+			seen[option] = true
+		}
+		return selected, nil
+	case QuestionTypeLikert:
+		point, err := strconv.Atoi(value)
+		if err != nil || point < question.Min || point > question.Max {
+			return nil, fmt.Errorf("the answer to question %s must be a whole number from %d to %d", question.ID, question.Min, question.Max)
+		}
+		return []string{strconv.Itoa(point)}, nil
+	case QuestionTypeNumeric:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) || number < float64(question.Min) || number > float64(question.Max) {
+			return nil, fmt.Errorf("the answer to question %s must be a number from %d to %d", question.ID, question.Min, question.Max)
+		}
+		return []string{strconv.FormatFloat(number, 'f', -1, 64)}, nil
+	case QuestionTypeText:
+		if value == "" {
+			return nil, fmt.Errorf("the answer to question %s is empty", question.ID)
+		}
+		return []string{value}, nil
+	}
+
+	return nil, fmt.Errorf("the question %s has unknown type %q", question.ID, question.Type)
+}
+
+// containsString returns true when values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,558 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ResultContract provides functions for tallying a poll and reading its results.
+type ResultContract struct {
+	contractapi.Contract
+}
+
+// Result describes the tally of a poll as endorsed by the TallyPoll transaction.
+type Result struct {
+	PollID    string            `json:"PollID"`
+	TxID      string            `json:"TxID"`
+	TalliedAt string            `json:"TalliedAt"`
+	Ballots   int               `json:"Ballots"`
+	Questions []*QuestionResult `json:"Questions"`
+
+	// AwaitingDecryption is set while the encrypted counts of a homomorphic
+	// poll have not been decrypted by all of its trustees; DecryptedBy lists
+	// the trustees that have submitted their decryption shares so far.
+	AwaitingDecryption bool     `json:"AwaitingDecryption,omitempty"`
+	DecryptedBy        []string `json:"DecryptedBy,omitempty"`
+}
+
+// QuestionResult describes how many times each answer was given to a question.
+// Every option and scale point is listed even when nobody chose it, and free
+// text answers are only counted in Total.
+type QuestionResult struct {
+	QuestionID string         `json:"QuestionID"`
+	Counts     map[string]int `json:"Counts"`
+	Total      int            `json:"Total"`
+
+	// EncryptedCounts holds the sum of the encrypted choices for each option
+	// of a homomorphic poll, and DecryptionShares the sum of the trustees'
+	// decryption shares submitted so far. Counts are left empty until every
+	// trustee has submitted their shares.
+	EncryptedCounts  map[string]Ciphertext `json:"EncryptedCounts,omitempty"`
+	DecryptionShares map[string]string     `json:"DecryptionShares,omitempty"`
+}
+
+// CrossTab describes the answers to a question broken down by a demographic
+// dimension. When it is returned by QueryVotes, QuestionID is empty and the
+// counts of each group are broken down by a second dimension, Breakdown,
+// instead of by answer. No group or count describes fewer than MinCellSize voters;
+// SuppressedVoters counts the voters of small groups that could not be merged
+// into a large enough group and were left out entirely.
+type CrossTab struct {
+	PollID           string           `json:"PollID"`
+	QuestionID       string           `json:"QuestionID,omitempty"`
+	Dimension        string           `json:"Dimension"`
+	Breakdown        string           `json:"Breakdown,omitempty"`
+	MinCellSize      int              `json:"MinCellSize"`
+	SuppressedVoters int              `json:"SuppressedVoters"`
+	Groups           []*CrossTabGroup `json:"Groups"`
+}
+
+// CrossTabGroup describes how the voters in one demographic group answered.
+// Answers whose count is withheld for privacy are listed in Suppressed instead of Counts.
+type CrossTabGroup struct {
+	Group      string         `json:"Group"`
+	Counts     map[string]int `json:"Counts"`
+	Suppressed []string       `json:"Suppressed,omitempty"`
+	Total      int            `json:"Total"`
+}
+
+// TallyPoll aggregates the answers of a Closed poll per question and per
+// answer, stores the outcome as the poll's Result and returns it. A poll can
+// be re-tallied until its results are published. A commit-reveal poll can
+// only be tallied once its reveal deadline has passed, so every tally counts
+// the same ballots.
+// Spoiled ballots are left out of the tally. The answers of a
+// homomorphic poll are added up without being decrypted, and the counts are
+// only known once its trustees have submitted their decryption shares.
+func (s *ResultContract) TallyPoll(ctx contractapi.TransactionContextInterface, pollID string) (*Result, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := readOwnedPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := effectivePollStatus(poll, now)
+	if status != PollStatusClosed {
+		return nil, fmt.Errorf("the poll %s is %s, only Closed polls can be tallied", pollID, status)
+	}
+
+	if pollMode(poll) == PollModeCommitReveal && !revealsClosed(poll, now) {
+		return nil, fmt.Errorf("the poll %s is accepting reveals until %s and cannot be tallied yet", pollID, poll.RevealsUntil)
+	}
+
+	questions, err := getPollQuestions(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	spoiled, err := spoiledVoteIDs(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Result{
+		PollID:    pollID,
+		TxID:      ctx.GetStub().GetTxID(),
+		TalliedAt: now.UTC().Format(time.RFC3339),
+		Questions: []*QuestionResult{},
+	}
+
+	for _, question := range questions {
+		questionResult := newQuestionResult(question)
+		result.Questions = append(result.Questions, questionResult)
+
+		answers, err := getQuestionAnswers(ctx, question.ID)
+		if err != nil {
+			return nil, err
+		}
+		answers = withoutSpoiled(answers, spoiled)
+		if pollMode(poll) == PollModeHomomorphic {
+			err = addEncryptedAnswers(poll, questionResult, question, answers)
+			if err != nil {
+				return nil, err
+			}
+			if len(questionResult.EncryptedCounts) > 0 {
+				questionResult.Counts = make(map[string]int)
+				result.AwaitingDecryption = true
+			}
+			continue
+		}
+		for _, answer := range answers {
+			err = countAnswer(questionResult, question, answer.Answer)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	voteIDs, err := getIndexedIDs(ctx, pollVoteIndex, pollID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range voteIDs {
+		if !spoiled[id] {
+			result.Ballots++
+		}
+	}
+
+	err = putResult(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// newQuestionResult returns an empty result for the given question.
+func newQuestionResult(question *Question) *QuestionResult {
+	questionResult := &QuestionResult{
+		QuestionID: question.ID,
+		Counts:     make(map[string]int),
+	}
+
+	switch question.Type {
+	case QuestionTypeSingleChoice, QuestionTypeMultipleChoice:
+		for _, option := range question.Options {
+			questionResult.Counts[option] = 0
+		}
+	case QuestionTypeLikert:
+		for point := question.Min; point <= question.Max; point++ {
+			questionResult.Counts[strconv.Itoa(point)] = 0
+		}
+	}
+
+	return questionResult
+}
+
+// countAnswer adds an answer to the question's result.
+func countAnswer(questionResult *QuestionResult, question *Question, value string) error {
+	values, err := answerValues(question, value)
+	if err != nil {
+		return err
+	}
+
+	questionResult.Total++
+	if question.Type == QuestionTypeText {
+		return nil
+	}
+	for _, v := range values {
+		questionResult.Counts[v]++
+	}
+
+	return nil
+}
+
+// withoutSpoiled returns the answers that do not belong to a spoiled vote.
+func withoutSpoiled(answers []*Answer, spoiled map[string]bool) []*Answer {
+	var kept []*Answer
+	for _, answer := range answers {
+		if !spoiled[answer.VoteID] {
+			kept = append(kept, answer)
+		}
+	}
+
+	return kept
+}
+
+// addEncryptedAnswers adds up the encrypted answers to a question of a
+// homomorphic poll per option.
+func addEncryptedAnswers(poll *Poll, questionResult *QuestionResult, question *Question, answers []*Answer) error {
+	options, err := encryptedOptions(question)
+	if err != nil {
+		return err
+	}
+
+	sums := make([][2]*point, len(options))
+	for i := range sums {
+		sums[i] = [2]*point{{new(big.Int), new(big.Int)}, {new(big.Int), new(big.Int)}}
+	}
+	for _, answer := range answers {
+		ciphertexts, err := parseEncryptedAnswer(poll, question, answer.Answer)
+		if err != nil {
+			return err
+		}
+		for i, ciphertext := range ciphertexts {
+			sums[i] = [2]*point{sums[i][0].add(ciphertext[0]), sums[i][1].add(ciphertext[1])}
+		}
+		questionResult.Total++
+	}
+
+	if questionResult.Total == 0 {
+		return nil
+	}
+	questionResult.EncryptedCounts = make(map[string]Ciphertext)
+	questionResult.DecryptionShares = make(map[string]string)
+	for i, option := range options {
+		questionResult.EncryptedCounts[option] = Ciphertext{A: sums[i][0].encode(), B: sums[i][1].encode()}
+	}
+
+	return nil
+}
+
+// SubmitDecryptionShares records a trustee's decryption shares for every
+// encrypted count of a homomorphic poll's result, after verifying the proof
+// attached to each share. Once every trustee has submitted their shares the
+// counts are decrypted and the result can be published. Only researchers and
+// admins can submit shares. The poll must still be Closed; re-tallying it
+// discards the shares submitted so far.
+func (s *ResultContract) SubmitDecryptionShares(ctx contractapi.TransactionContextInterface, pollID string, trustee string, shares []DecryptionShare) (*Result, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := readPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := effectivePollStatus(poll, now)
+	if status != PollStatusClosed {
+		return nil, fmt.Errorf("the poll %s is %s, only Closed polls can be decrypted", pollID, status)
+	}
+
+	result, err := readResult(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if !result.AwaitingDecryption {
+		return nil, fmt.Errorf("the result of poll %s is not awaiting decryption", pollID)
+	}
+
+	y, err := decodePoint(trustee)
+	if err != nil {
+		return nil, err
+	}
+	trustee = y.encode()
+	if !containsString(poll.Trustees, trustee) {
+		return nil, fmt.Errorf("%s is not a trustee of poll %s", trustee, pollID)
+	}
+	if containsString(result.DecryptedBy, trustee) {
+		return nil, fmt.Errorf("the trustee %s has already submitted their shares", trustee)
+	}
+
+	questionResults := make(map[string]*QuestionResult)
+	expected := 0
+	for _, questionResult := range result.Questions {
+		questionResults[questionResult.QuestionID] = questionResult
+		expected += len(questionResult.EncryptedCounts)
+	}
+
+	g := generator()
+	decrypted := make(map[string]map[string]bool)
+	for _, share := range shares {
+		questionResult, ok := questionResults[share.QuestionID]
+		if !ok {
+			return nil, fmt.Errorf("the question %s is not part of the result of poll %s", share.QuestionID, pollID)
+		}
+		ciphertext, ok := questionResult.EncryptedCounts[share.Option]
+		if !ok {
+			return nil, fmt.Errorf("there is no encrypted count for %q of question %s", share.Option, share.QuestionID)
+		}
+		if decrypted[share.QuestionID][share.Option] {
+			return nil, fmt.Errorf("the share for %q of question %s is submitted more than once", share.Option, share.QuestionID)
+		}
+
+		a, _, err := decodeCiphertext(ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		d, err := decodePoint(share.Share)
+		if err != nil {
+			return nil, err
+		}
+
+		context := fmt.Sprintf("%s|%s|%s|decrypt", pollID, share.QuestionID, share.Option)
+		if !verifyDLEQ(context, g, y, a, d, share.Proof) {
+			return nil, fmt.Errorf("invalid proof for the share of %q of question %s", share.Option, share.QuestionID)
+		}
+
+		sum := d
+		if previous, ok := questionResult.DecryptionShares[share.Option]; ok {
+			p, err := decodePoint(previous)
+			if err != nil {
+				return nil, err
+			}
+			sum = sum.add(p)
+		}
+		questionResult.DecryptionShares[share.Option] = sum.encode()
+
+		if decrypted[share.QuestionID] == nil {
+			decrypted[share.QuestionID] = make(map[string]bool)
+		}
+		decrypted[share.QuestionID][share.Option] = true
+	}
+	if len(shares) != expected {
+		return nil, fmt.Errorf("the trustee must submit one share for each of the %d encrypted counts", expected)
+	}
+
+	result.DecryptedBy = append(result.DecryptedBy, trustee)
+	if len(result.DecryptedBy) == len(poll.Trustees) {
+		err = decryptCounts(result)
+		if err != nil {
+			return nil, err
+		}
+		result.AwaitingDecryption = false
+	}
+
+	err = putResult(ctx, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// decryptCounts fills in the counts of a homomorphic poll's result from its
+// encrypted counts and the combined decryption shares of every trustee.
+func decryptCounts(result *Result) error {
+	for _, questionResult := range result.Questions {
+		for option, ciphertext := range questionResult.EncryptedCounts {
+			_, b, err := decodeCiphertext(ciphertext)
+			if err != nil {
+				return err
+			}
+			d, err := decodePoint(questionResult.DecryptionShares[option])
+			if err != nil {
+				return err
+			}
+
+			count, err := discreteLog(b.sub(d), questionResult.Total)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt the count of %q of question %s: %v", option, questionResult.QuestionID, err)
+			}
+			questionResult.Counts[option] = count
+		}
+	}
+
+	return nil
+}
+
+// GetResults returns the stored result of the given poll. Once a poll's
+// results are published anyone can read them; before that only researchers,
+// auditors and admins can.
+func (s *ResultContract) GetResults(ctx contractapi.TransactionContextInterface, pollID string) (*Result, error) {
+	_, err := readResultsPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	return readResult(ctx, pollID)
+}
+
+// GetCrossTab returns the distribution of answers to the given question split
+// by a demographic dimension of the voters: Age, Gender, Occupation or
+// Country. Ages are grouped into the poll's age bands, and small groups and
+// counts are merged or suppressed according to the poll's k-anonymity
+// threshold. Like GetResults, it is public once the poll's results are published.
+func (s *ResultContract) GetCrossTab(ctx contractapi.TransactionContextInterface, pollID string, questionID string, dimension string) (*CrossTab, error) {
+	poll, err := readResultsPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	question, err := readQuestion(ctx, questionID)
+	if err != nil {
+		return nil, err
+	}
+	if question.PollID != pollID {
+		return nil, fmt.Errorf("the question %s does not belong to poll %s", questionID, pollID)
+	}
+	if question.Type == QuestionTypeText {
+		return nil, fmt.Errorf("the text question %s cannot be cross-tabulated", questionID)
+	}
+	if pollMode(poll) == PollModeHomomorphic {
+		return nil, fmt.Errorf("the answers to poll %s are encrypted and cannot be cross-tabulated", pollID)
+	}
+
+	dimension, group, err := dimensionGroup(dimension, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	votes, err := getPollVotes(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	spoiled, err := spoiledVoteIDs(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	voteGroups := make(map[string]string)
+	for _, vote := range votes {
+		if !spoiled[vote.ID] {
+			voteGroups[vote.ID] = group(vote)
+		}
+	}
+
+	answers, err := getQuestionAnswers(ctx, questionID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupResults := make(map[string]*QuestionResult)
+	for _, answer := range answers {
+		name, ok := voteGroups[answer.VoteID]
+		if !ok {
+			continue
+		}
+		if _, ok := groupResults[name]; !ok {
+			groupResults[name] = newQuestionResult(question)
+		}
+		err = countAnswer(groupResults[name], question, answer.Answer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	crossTab := CrossTab{
+		PollID:     pollID,
+		QuestionID: questionID,
+		Dimension:  dimension,
+		Groups:     []*CrossTabGroup{},
+	}
+	for name, groupResult := range groupResults {
+		crossTab.Groups = append(crossTab.Groups, &CrossTabGroup{
+			Group:  name,
+			Counts: groupResult.Counts,
+			Total:  groupResult.Total,
+		})
+	}
+	sort.Slice(crossTab.Groups, func(i, j int) bool {
+		return crossTab.Groups[i].Group < crossTab.Groups[j].Group
+	})
+	suppressSmallCells(&crossTab, pollMinCellSize(poll))
+
+	return &crossTab, nil
+}
+
+// readResultsPoll returns the poll with given id, or an error unless its
+// results are published or the client is a researcher, auditor or admin.
+func readResultsPoll(ctx contractapi.TransactionContextInterface, pollID string) (*Poll, error) {
+	poll, err := readPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	if poll.Status != PollStatusTallied && poll.Status != PollStatusArchived {
+		err = assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return poll, nil
+}
+
+// readResult returns the result of the given poll stored in the world state.
+func readResult(ctx contractapi.TransactionContextInterface, pollID string) (*Result, error) {
+	key, err := resultKey(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	resultJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if resultJSON == nil {
+		return nil, fmt.Errorf("the poll %s has not been tallied", pollID)
+	}
+
+	var result Result
+	err = json.Unmarshal(resultJSON, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// putResult writes the given result to the world state and records who wrote it.
+func putResult(ctx contractapi.TransactionContextInterface, result *Result) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	key, err := resultKey(ctx, result.PollID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, resultJSON)
+	if err != nil {
+		return err
+	}
+
+	return recordSubmitter(ctx, resultObjectType, result.PollID)
+}
@@ -1,165 +1,1056 @@
 package chaincode
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"time"
 
-	"github.com/Hsin75c/bc-evoting/chaincode-go/chaincode"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// SmartContract provides functions for managing a poll.
-type SmartContract struct {
+// PaginatedVotes describes one page of votes and the bookmark of the next page.
+type PaginatedVotes struct {
+	Records      []*Vote `json:"records"`
+	Bookmark     string  `json:"bookmark"`
+	FetchedCount int32   `json:"fetchedCount"`
+}
+
+// VoteContract provides functions for managing a vote.
+type VoteContract struct {
 	contractapi.Contract
 }
 
-// Vote describes specified details of what makes up a vote.
+// Vote describes specified details of what makes up a vote. Votes are stored
+// in the ballot private data collection.
+// DocType is filled in when the vote is stored and AgeBand when it is cast, so
+// that CouchDB rich queries can select votes and filter them by age band.
 type Vote struct {
-	ID 		        string    	`json:"ID"`
-	BCReceipt	    string    	`json:"BCReceipt"`
-	Age 		    string 		`json:"Age"`
-	Gender          string      `json:"Gender"`
-	Occupation	    string 		`json:"Occupation"`
-	Country         string      `json:"Country"`
-}
-
-// InitLedger adds the first vote of the live testing poll into the ledger.
-func (s *SmartContract) InitLedgerVote(ctx contractapi.TransactionContextInterface) error {
-	votes := []Vote{
-			{ID: "1-1", BCReceipt: "", Age: "23", Gender: "Female", Occupation: "Student", Country: "Malaysia"},
-		}
-		
-	for _, vote := range votes {
-		voteJSON, err := json.Marshal(vote)
-		if err != nil {
-			return err
-		}
+	DocType    string `json:"docType"`
+	ID         string `json:"ID"`
+	PollID     string `json:"PollID"`
+	BCReceipt  string `json:"BCReceipt"`
+	Age        string `json:"Age"`
+	AgeBand    string `json:"AgeBand"`
+	Gender     string `json:"Gender"`
+	Occupation string `json:"Occupation"`
+	Country    string `json:"Country"`
+}
+
+// Ballot describes a voter's full submission to a poll: the answers to its
+// questions along with the voter's demographics.
+type Ballot struct {
+	Answers    []BallotAnswer `json:"Answers"`
+	Age        string         `json:"Age"`
+	Gender     string         `json:"Gender"`
+	Occupation string         `json:"Occupation"`
+	Country    string         `json:"Country"`
+}
+
+// BallotAnswer describes the answer given to a single question on a ballot.
+// Optional questions that were skipped are simply left out of the ballot.
+type BallotAnswer struct {
+	QuestionID string `json:"QuestionID"`
+	Answer     string `json:"Answer"`
+}
+
+// CastVote records a full ballot for the given poll in a single transaction.
+// The ballot is validated against the poll's questions before anything is
+// written, so either every answer and the voter's demographics are stored or
+// nothing is. Each client may only cast one ballot per poll, which can then
+// only be corrected with SpoilBallot or ReplaceBallot.
+// The ballot is read as JSON from the "ballot" transient field so it never
+// appears in the transaction proposal, and is written to the ballot private
+// data collection; only its hash reaches the channel ledger.
+// The returned receipt commits to the ballot and to a secret nonce the voter
+// passes in the "nonce" transient field, see VerifyReceipt.
+// Commit-reveal polls do not accept ballots this way, see CommitBallot.
+// Polls with an eligibility list also need the voter's inclusion proof in the
+// "eligibility" transient field, see assertEligible.
+func (s *VoteContract) CastVote(ctx contractapi.TransactionContextInterface, pollID string) (*Receipt, error) {
+	err := assertRole(ctx, RoleVoter)
+	if err != nil {
+		return nil, err
+	}
+
+	ballot, nonce, err := transientBallot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := readPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if pollMode(poll) == PollModeCommitReveal {
+		return nil, fmt.Errorf("the poll %s is in %s mode and only accepts committed ballots", pollID, pollMode(poll))
+	}
+	if poll.TokenIssuerKey != "" {
+		return nil, fmt.Errorf("the poll %s only accepts anonymous ballots", pollID)
+	}
+
+	err = checkPollAcceptingVotes(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateBallot(ctx, poll, ballot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = assertEligible(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	err = markVoted(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := recordBallot(ctx, poll, ballot, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putBallotOwner(ctx, poll, receipt.TxID)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// SpoilBallot withdraws the ballot the submitting client cast in the given
+// poll with CastVote or ReplaceBallot. The ballot itself is left untouched;
+// it is marked as spoiled in the public ballot log and ignored when the poll
+// is tallied. Ballots can only be spoiled by the voter who cast them, while
+// the poll is open. The voter may still cast a new ballot with ReplaceBallot.
+func (s *VoteContract) SpoilBallot(ctx contractapi.TransactionContextInterface, pollID string) error {
+	err := assertRole(ctx, RoleVoter)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readCorrectablePoll(ctx, pollID)
+	if err != nil {
+		return err
+	}
+
+	voteID, err := readBallotOwner(ctx, poll)
+	if err != nil {
+		return err
+	}
+
+	spoiled, err := readSpoiledBallot(ctx, pollID, voteID)
+	if err != nil {
+		return err
+	}
+	if spoiled != nil {
+		return fmt.Errorf("the client's ballot in poll %s is already spoiled", pollID)
+	}
+
+	spoiled, err = newSpoiledBallot(ctx, pollID, voteID)
+	if err != nil {
+		return err
+	}
+
+	err = putSpoiledBallot(ctx, spoiled)
+	if err != nil {
+		return err
+	}
+
+	return emitPollEvent(ctx, EventBallotSpoiled, poll)
+}
+
+// ReplaceBallot spoils the ballot the submitting client cast in the given
+// poll, unless it is already spoiled, and records the ballot passed in the
+// "ballot" transient field in its place, returning the new receipt. The log
+// entry of the spoiled ballot records the ID of the vote that replaced it. Like
+// SpoilBallot it is only allowed for the original voter while the poll is open.
+func (s *VoteContract) ReplaceBallot(ctx contractapi.TransactionContextInterface, pollID string) (*Receipt, error) {
+	err := assertRole(ctx, RoleVoter)
+	if err != nil {
+		return nil, err
+	}
+
+	ballot, nonce, err := transientBallot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := readCorrectablePoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateBallot(ctx, poll, ballot)
+	if err != nil {
+		return nil, err
+	}
 
-		err = ctx.GetStub().PutState(vote.ID, voteJSON)
+	voteID, err := readBallotOwner(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	spoiled, err := readSpoiledBallot(ctx, pollID, voteID)
+	if err != nil {
+		return nil, err
+	}
+	if spoiled == nil {
+		spoiled, err = newSpoiledBallot(ctx, pollID, voteID)
 		if err != nil {
-			return fmt.Errorf("failed to put to world state. %v", err)
+			return nil, err
 		}
 	}
+	spoiled.ReplacedBy = ctx.GetStub().GetTxID()
 
-	return nil
+	err = putSpoiledBallot(ctx, spoiled)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := recordBallot(ctx, poll, ballot, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putBallotOwner(ctx, poll, receipt.TxID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = emitPollEvent(ctx, EventBallotReplaced, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// GetSpoiledBallots returns the public log of the ballots spoiled or replaced in the given poll.
+func (s *VoteContract) GetSpoiledBallots(ctx contractapi.TransactionContextInterface, pollID string) ([]*SpoiledBallot, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	return getSpoiledBallots(ctx, pollID)
+}
+
+// CastAnonymousVote records a full ballot for the given poll like CastVote,
+// but for polls with a token issuer: instead of the identity submitting the
+// transaction, the ballot is authorized by the anonymous token passed in the
+// "token" transient field, whose serial is then marked as spent. Any client,
+// such as a relay shared by all voters, may submit anonymous ballots, so the
+// ledger never learns which registered voter cast which ballot.
+func (s *VoteContract) CastAnonymousVote(ctx contractapi.TransactionContextInterface, pollID string) (*Receipt, error) {
+	ballot, nonce, err := transientBallot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := readPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll.TokenIssuerKey == "" {
+		return nil, fmt.Errorf("the poll %s does not accept anonymous ballots", pollID)
+	}
+	if pollMode(poll) == PollModeCommitReveal {
+		return nil, fmt.Errorf("the poll %s is in %s mode and only accepts committed ballots", pollID, pollMode(poll))
+	}
+
+	err = checkPollAcceptingVotes(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateBallot(ctx, poll, ballot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = spendToken(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	return recordBallot(ctx, poll, ballot, nonce)
 }
 
-// CreatePoll issues a new poll to the world state with given details
-func (s *SmartContract) CreatePoll(ctx contractapi.TransactionContextInterface, id string, name string, researcher string, description string, status string) error {
-	exists, err := s.PollExists(ctx, id)
+// CommitBallot records the voter's commitment to a ballot in the given
+// commit-reveal poll while it is open. The commitment is computed like the
+// commitment of a receipt: the hex-encoded SHA-256 hash of the canonical
+// ballot JSON followed by a secret nonce of at least 16 bytes. Each client may
+// only commit once, and must prove their eligibility like in CastVote.
+func (s *VoteContract) CommitBallot(ctx contractapi.TransactionContextInterface, pollID string, commitment string) error {
+	err := assertRole(ctx, RoleVoter)
+	if err != nil {
+		return err
+	}
+
+	poll, err := readPoll(ctx, pollID)
 	if err != nil {
 		return err
 	}
-	if exists {
-		return fmt.Errorf("the poll %s already exists", id)
+	if pollMode(poll) != PollModeCommitReveal {
+		return fmt.Errorf("the poll %s is not in %s mode", pollID, PollModeCommitReveal)
+	}
+	if poll.TokenIssuerKey != "" {
+		return fmt.Errorf("the poll %s only accepts anonymous ballots", pollID)
+	}
+
+	err = checkPollAcceptingVotes(ctx, poll)
+	if err != nil {
+		return err
 	}
 
-	poll := Poll{
-		ID:            id,
-		Name:          name,
-		Researcher:    researcher,
-		Description:   description,
-		Status:        status,
+	decoded, err := hex.DecodeString(commitment)
+	if err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("the commitment must be a hex-encoded SHA-256 hash")
 	}
-	pollJSON, err := json.Marshal(poll)
+
+	err = assertEligible(ctx, poll)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, pollJSON)
+	err = markVoted(ctx, poll)
+	if err != nil {
+		return err
+	}
+
+	key, err := voterCommitmentKey(ctx, poll)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, []byte(commitment))
 }
 
-// ReadPoll returns the poll stored in the world state with given id.
-func (s *SmartContract) ReadPoll(ctx contractapi.TransactionContextInterface, id string) (*Poll, error) {
-	pollJSON, err := ctx.GetStub().GetState(id)
+// RevealBallot records the ballot the voter committed to in the given
+// commit-reveal poll, once the poll is closed and until its reveal deadline.
+// The ballot and nonce are read from the "ballot" and "nonce" transient fields
+// and must match the commitment; only revealed ballots are ever tallied.
+func (s *VoteContract) RevealBallot(ctx contractapi.TransactionContextInterface, pollID string) (*Receipt, error) {
+	err := assertRole(ctx, RoleVoter)
+	if err != nil {
+		return nil, err
+	}
+
+	ballot, nonce, err := transientBallot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := readPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if pollMode(poll) != PollModeCommitReveal {
+		return nil, fmt.Errorf("the poll %s is not in %s mode", pollID, PollModeCommitReveal)
+	}
+
+	err = checkPollRevealingBallots(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := voterCommitmentKey(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	commitment, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from world state: %v", err)
 	}
-	if pollJSON == nil {
-		return nil, fmt.Errorf("the poll %s does not exist", id)
+	if commitment == nil {
+		return nil, fmt.Errorf("the client has no unrevealed commitment in poll %s", pollID)
+	}
+	if ballotCommitment(ballot, nonce) != string(commitment) {
+		return nil, fmt.Errorf("the ballot does not match the commitment")
+	}
+
+	err = validateBallot(ctx, poll, ballot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return recordBallot(ctx, poll, ballot, nonce)
+}
+
+// ReadVote returns the vote stored in the private data collection with given id.
+func (s *VoteContract) ReadVote(ctx contractapi.TransactionContextInterface, id string) (*Vote, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	return readVote(ctx, id)
+}
+
+// VoteExists returns true when vote with given ID exists in the private data collection
+func (s *VoteContract) VoteExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := voteKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	voteJSON, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from private data: %v", err)
 	}
 
-	var poll Poll
-	err = json.Unmarshal(pollJSON, &poll)
+	return voteJSON != nil, nil
+}
+
+// GetAllVotes returns all votes found in the private data collection.
+func (s *VoteContract) GetAllVotes(ctx contractapi.TransactionContextInterface) ([]*Vote, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	return getAllVotes(ctx)
+}
+
+// GetVotesByPoll returns all votes cast in the poll with given id.
+func (s *VoteContract) GetVotesByPoll(ctx contractapi.TransactionContextInterface, pollID string) ([]*Vote, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
 	if err != nil {
 		return nil, err
 	}
 
-	return &poll, nil
+	return getPollVotes(ctx, pollID)
 }
 
-// UpdatePoll updates an existing poll in the world state with provided parameters.
-func (s *SmartContract) UpdatePoll(ctx contractapi.TransactionContextInterface, id string, name string, researcher string, description string, status string) error {
-	exists, err := s.PollExists(ctx, id)
+// GetVotesByPollWithPagination returns one page of at most pageSize votes
+// cast in the poll with given id, starting at the given bookmark.
+func (s *VoteContract) GetVotesByPollWithPagination(ctx contractapi.TransactionContextInterface, pollID string, pageSize int32, bookmark string) (*PaginatedVotes, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, nextBookmark, fetchedCount, err := getIndexedIDsWithPagination(ctx, pollVoteIndex, pollID, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	votes := []*Vote{}
+	for _, id := range ids {
+		vote, err := readVote(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+
+	return &PaginatedVotes{
+		Records:      votes,
+		Bookmark:     nextBookmark,
+		FetchedCount: fetchedCount,
+	}, nil
+}
+
+// BallotHash describes the hash of a private vote record as seen on the channel ledger.
+type BallotHash struct {
+	VoteID string `json:"VoteID"`
+	Hash   string `json:"Hash"`
+}
+
+// GetBallotHashes returns the on-chain hash of every vote cast in the given
+// poll. It only reads public data, so organizations outside the ballot
+// collection can use it to verify the number of ballots behind a result
+// without reading any individual response.
+func (s *VoteContract) GetBallotHashes(ctx contractapi.TransactionContextInterface, pollID string) ([]*BallotHash, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := getIndexedIDs(ctx, pollVoteIndex, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []*BallotHash{}
+	for _, id := range ids {
+		key, err := voteKey(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err := ctx.GetStub().GetPrivateDataHash(ballotCollection, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private data hash: %v", err)
+		}
+		hashes = append(hashes, &BallotHash{VoteID: id, Hash: hex.EncodeToString(hash)})
+	}
+
+	return hashes, nil
+}
+
+// QueryVotes counts the votes of one poll matching the given CouchDB selector,
+// e.g. {"PollID":"1","Country":"Malaysia"}, broken down by the demographic
+// dimension and, within each of its groups, by the breakdown dimension. The
+// selector must pin PollID to a literal value, and the counts are subject to
+// the k-anonymity threshold of that poll exactly like GetCrossTab; individual
+// votes are never returned. Spoiled ballots are left out. It requires CouchDB
+// as the state database.
+func (s *VoteContract) QueryVotes(ctx contractapi.TransactionContextInterface, selectorJSON string, dimension string, breakdown string) (*CrossTab, error) {
+	err := assertRole(ctx, RoleResearcher, RoleAuditor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString, pollID, err := voteQuery(selectorJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := readPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	dimension, group, err := dimensionGroup(dimension, poll)
+	if err != nil {
+		return nil, err
+	}
+	breakdown, column, err := dimensionGroup(breakdown, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	spoiled, err := spoiledVoteIDs(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(ballotCollection, queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	matched := 0
+	groups := make(map[string]*CrossTabGroup)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var vote Vote
+		err = json.Unmarshal(queryResponse.Value, &vote)
+		if err != nil {
+			return nil, err
+		}
+		if vote.PollID != pollID || spoiled[vote.ID] {
+			continue
+		}
+
+		name := group(&vote)
+		if _, ok := groups[name]; !ok {
+			groups[name] = &CrossTabGroup{Group: name, Counts: make(map[string]int)}
+		}
+		groups[name].Counts[column(&vote)]++
+		groups[name].Total++
+		matched++
+	}
+
+	err = assertQueryNotTooNarrow(poll, matched)
+	if err != nil {
+		return nil, err
+	}
+
+	crossTab := CrossTab{
+		PollID:    pollID,
+		Dimension: dimension,
+		Breakdown: breakdown,
+		Groups:    []*CrossTabGroup{},
+	}
+	for _, crossTabGroup := range groups {
+		crossTab.Groups = append(crossTab.Groups, crossTabGroup)
+	}
+	sort.Slice(crossTab.Groups, func(i, j int) bool {
+		return crossTab.Groups[i].Group < crossTab.Groups[j].Group
+	})
+	suppressSmallCells(&crossTab, pollMinCellSize(poll))
+
+	return &crossTab, nil
+}
+
+// transientBallot returns the ballot and nonce passed in the transient data.
+func transientBallot(ctx contractapi.TransactionContextInterface) (*Ballot, []byte, error) {
+	ballotJSON, err := transientValue(ctx, ballotTransientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ballot Ballot
+	err = json.Unmarshal(ballotJSON, &ballot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse ballot: %v", err)
+	}
+
+	nonce, err := receiptNonce(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ballot, nonce, nil
+}
+
+// recordBallot writes the given validated ballot to the private data
+// collection as a vote and its answers, stores its public receipt and emits
+// the BallotCast event.
+func recordBallot(ctx contractapi.TransactionContextInterface, poll *Poll, ballot *Ballot, nonce []byte) (*Receipt, error) {
+	voteID := ctx.GetStub().GetTxID()
+	vote := Vote{
+		ID:         voteID,
+		PollID:     poll.ID,
+		BCReceipt:  voteID,
+		Age:        ballot.Age,
+		AgeBand:    ageBand(ballot.Age, pollAgeBands(poll)),
+		Gender:     ballot.Gender,
+		Occupation: ballot.Occupation,
+		Country:    ballot.Country,
+	}
+	err := putVote(ctx, &vote)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ballotAnswer := range ballot.Answers {
+		answer := Answer{
+			ID:         fmt.Sprintf("%s-%s", ballotAnswer.QuestionID, voteID),
+			QuestionID: ballotAnswer.QuestionID,
+			VoteID:     voteID,
+			Answer:     ballotAnswer.Answer,
+		}
+		err = putAnswer(ctx, &answer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	receipt := Receipt{
+		TxID:       voteID,
+		PollID:     poll.ID,
+		Commitment: ballotCommitment(ballot, nonce),
+	}
+	err = putReceipt(ctx, &receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = emitPollEvent(ctx, EventBallotCast, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+// SpoiledBallot is the public log entry of a spoiled ballot. ReplacedBy is
+// the ID of the vote that replaced it, if any.
+type SpoiledBallot struct {
+	PollID     string `json:"PollID"`
+	VoteID     string `json:"VoteID"`
+	TxID       string `json:"TxID"`
+	Timestamp  string `json:"Timestamp"`
+	ReplacedBy string `json:"ReplacedBy,omitempty"`
+}
+
+// readCorrectablePoll returns the poll with given id, or an error unless
+// ballots cast in it can currently be spoiled or replaced.
+func readCorrectablePoll(ctx contractapi.TransactionContextInterface, pollID string) (*Poll, error) {
+	poll, err := readPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if pollMode(poll) == PollModeCommitReveal {
+		return nil, fmt.Errorf("ballots of %s poll %s cannot be spoiled", PollModeCommitReveal, pollID)
+	}
+	if poll.TokenIssuerKey != "" {
+		return nil, fmt.Errorf("anonymous ballots of poll %s cannot be spoiled", pollID)
+	}
+
+	err = checkPollAcceptingVotes(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	return poll, nil
+}
+
+// putBallotOwner records in the private data collection that the latest
+// ballot of the submitting client in the given poll is the vote with given id.
+func putBallotOwner(ctx contractapi.TransactionContextInterface, poll *Poll, voteID string) error {
+	hash, err := voterHash(ctx, poll)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the poll %s does not exist", id)
+
+	key, err := ballotOwnerKey(ctx, poll.ID, hash)
+	if err != nil {
+		return err
 	}
 
-	// overwriting original poll with new poll
-	poll := Poll{
-		ID:             id,
-		Name:           name,
-		Researcher:     researcher,
-		Description:    description,
-		Status: 		status,
+	return ctx.GetStub().PutPrivateData(ballotCollection, key, []byte(voteID))
+}
+
+// readBallotOwner returns the ID of the latest ballot the submitting client
+// cast in the given poll.
+func readBallotOwner(ctx contractapi.TransactionContextInterface, poll *Poll) (string, error) {
+	hash, err := voterHash(ctx, poll)
+	if err != nil {
+		return "", err
 	}
-	pollJSON, err := json.Marshal(poll)
+
+	key, err := ballotOwnerKey(ctx, poll.ID, hash)
+	if err != nil {
+		return "", err
+	}
+
+	voteID, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from private data: %v", err)
+	}
+	if voteID == nil {
+		return "", fmt.Errorf("the client has not cast a ballot in poll %s", poll.ID)
+	}
+
+	return string(voteID), nil
+}
+
+// readSpoiledBallot returns the log entry of the given vote, or nil if it is not spoiled.
+func readSpoiledBallot(ctx contractapi.TransactionContextInterface, pollID string, voteID string) (*SpoiledBallot, error) {
+	key, err := spoiledKey(ctx, pollID, voteID)
+	if err != nil {
+		return nil, err
+	}
+
+	spoiledJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if spoiledJSON == nil {
+		return nil, nil
+	}
+
+	var spoiled SpoiledBallot
+	err = json.Unmarshal(spoiledJSON, &spoiled)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spoiled, nil
+}
+
+// newSpoiledBallot returns the log entry spoiling the given vote in the current transaction.
+func newSpoiledBallot(ctx contractapi.TransactionContextInterface, pollID string, voteID string) (*SpoiledBallot, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SpoiledBallot{
+		PollID:    pollID,
+		VoteID:    voteID,
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: now.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// putSpoiledBallot writes the given entry to the public log of spoiled ballots.
+func putSpoiledBallot(ctx contractapi.TransactionContextInterface, spoiled *SpoiledBallot) error {
+	spoiledJSON, err := json.Marshal(spoiled)
+	if err != nil {
+		return err
+	}
+
+	key, err := spoiledKey(ctx, spoiled.PollID, spoiled.VoteID)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, pollJSON)
+	return ctx.GetStub().PutState(key, spoiledJSON)
 }
 
-// DeletePoll deletes an given asset from the world state.
-func (s *SmartContract) DeletePoll(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.PollExists(ctx, id)
+// getSpoiledBallots returns the log entries of the ballots spoiled in the given poll.
+func getSpoiledBallots(ctx contractapi.TransactionContextInterface, pollID string) ([]*SpoiledBallot, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(spoiledObjectType, []string{pollID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	spoiledBallots := []*SpoiledBallot{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var spoiled SpoiledBallot
+		err = json.Unmarshal(queryResponse.Value, &spoiled)
+		if err != nil {
+			return nil, err
+		}
+		spoiledBallots = append(spoiledBallots, &spoiled)
+	}
+
+	return spoiledBallots, nil
+}
+
+// spoiledVoteIDs returns the set of IDs of the votes spoiled in the given poll.
+func spoiledVoteIDs(ctx contractapi.TransactionContextInterface, pollID string) (map[string]bool, error) {
+	spoiledBallots, err := getSpoiledBallots(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, spoiled := range spoiledBallots {
+		ids[spoiled.VoteID] = true
+	}
+
+	return ids, nil
+}
+
+// assertPrivateKeyUnused returns an error if the given key of the ballot
+// collection already holds a value. Only the value's hash is read, so the
+// check works on every peer.
+func assertPrivateKeyUnused(ctx contractapi.TransactionContextInterface, key string) error {
+	hash, err := ctx.GetStub().GetPrivateDataHash(ballotCollection, key)
+	if err != nil {
+		return fmt.Errorf("failed to read private data hash: %v", err)
+	}
+	if hash != nil {
+		return fmt.Errorf("ballots are write-once")
+	}
+
+	return nil
+}
+
+// voterCommitmentKey returns the world state key of the submitting client's
+// commitment in the given poll.
+func voterCommitmentKey(ctx contractapi.TransactionContextInterface, poll *Poll) (string, error) {
+	hash, err := voterHash(ctx, poll)
+	if err != nil {
+		return "", err
+	}
+
+	return commitmentKey(ctx, poll.ID, hash)
+}
+
+// readVote returns the vote stored in the private data collection with given id.
+func readVote(ctx contractapi.TransactionContextInterface, id string) (*Vote, error) {
+	key, err := voteKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	voteJSON, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from private data: %v", err)
+	}
+	if voteJSON == nil {
+		return nil, fmt.Errorf("the vote %s does not exist", id)
+	}
+
+	var vote Vote
+	err = json.Unmarshal(voteJSON, &vote)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vote, nil
+}
+
+// putVote writes the given vote to the private data collection and indexes it
+// under its poll. A vote, once written, is never overwritten.
+func putVote(ctx contractapi.TransactionContextInterface, vote *Vote) error {
+	vote.DocType = voteObjectType
+
+	voteJSON, err := json.Marshal(vote)
+	if err != nil {
+		return err
+	}
+
+	key, err := voteKey(ctx, vote.ID)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the poll %s does not exist", id)
+
+	err = assertPrivateKeyUnused(ctx, key)
+	if err != nil {
+		return fmt.Errorf("the vote %s is already recorded: %v", vote.ID, err)
 	}
 
-	return ctx.GetStub().DelState(id)
+	err = ctx.GetStub().PutPrivateData(ballotCollection, key, voteJSON)
+	if err != nil {
+		return err
+	}
+
+	return putIndexEntry(ctx, pollVoteIndex, vote.PollID, vote.ID)
 }
 
-// pollExists returns true when poll with given ID exists in world state
-func (s *SmartContract) PollExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	pollJSON, err := ctx.GetStub().GetState(id)
+// validateBallot returns an error unless the ballot answers every required
+// question of the given poll, answers each question at most once, and every
+// answer fits its question's type.
+func validateBallot(ctx contractapi.TransactionContextInterface, poll *Poll, ballot *Ballot) error {
+	pollID := poll.ID
+	questions, err := getPollQuestions(ctx, pollID)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return err
+	}
+
+	pollQuestions := make(map[string]*Question)
+	for _, question := range questions {
+		pollQuestions[question.ID] = question
+	}
+
+	answered := make(map[string]bool)
+	for _, ballotAnswer := range ballot.Answers {
+		question, ok := pollQuestions[ballotAnswer.QuestionID]
+		if !ok {
+			return fmt.Errorf("the question %s does not belong to poll %s", ballotAnswer.QuestionID, pollID)
+		}
+		if answered[question.ID] {
+			return fmt.Errorf("the question %s is answered more than once", question.ID)
+		}
+		err = validateAnswer(poll, question, ballotAnswer.Answer)
+		if err != nil {
+			return err
+		}
+		answered[question.ID] = true
+	}
+
+	for _, question := range questions {
+		if question.Required && !answered[question.ID] {
+			return fmt.Errorf("the ballot does not answer required question %s", question.ID)
+		}
+	}
+
+	return nil
+}
+
+// validateAnswer returns an error unless value is a valid answer to the given
+// question: a plain answer, or an encrypted one for homomorphic polls.
+func validateAnswer(poll *Poll, question *Question, value string) error {
+	if pollMode(poll) == PollModeHomomorphic {
+		_, err := parseEncryptedAnswer(poll, question, value)
+		return err
 	}
 
-	return pollJSON != nil, nil
+	_, err := answerValues(question, value)
+	return err
 }
 
-// GetAllPolls returns all polls found in the world state.
-func (s *SmartContract) GetAllPolls(ctx contractapi.TransactionContextInterface) ([]*Poll, error) {
+// getPollVotes returns all votes cast in the poll with given id.
+func getPollVotes(ctx contractapi.TransactionContextInterface, pollID string) ([]*Vote, error) {
+	ids, err := getIndexedIDs(ctx, pollVoteIndex, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	var votes []*Vote
+	for _, id := range ids {
+		vote, err := readVote(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+
+	return votes, nil
+}
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+// getAllVotes returns all votes found in the private data collection.
+func getAllVotes(ctx contractapi.TransactionContextInterface) ([]*Vote, error) {
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(ballotCollection, voteObjectType, []string{})
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	var polls []*Poll
+	var votes []*Vote
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
 
-		var poll Poll
-		err = json.Unmarshal(queryResponse.Value, &poll)
+		var vote Vote
+		err = json.Unmarshal(queryResponse.Value, &vote)
 		if err != nil {
 			return nil, err
 		}
-		polls = append(polls, &poll)
+		votes = append(votes, &vote)
 	}
 
-	return polls, nil
+	return votes, nil
+}
+
+// voteQuery wraps the given CouchDB selector in a query that only matches
+// votes, and returns it along with the poll ID the selector pins. Selectors
+// that do not set PollID to a literal value are refused, since they could
+// match the votes of several polls or bypass the poll's k-anonymity threshold.
+func voteQuery(selectorJSON string) (string, string, error) {
+	var selector map[string]interface{}
+	err := json.Unmarshal([]byte(selectorJSON), &selector)
+	if err != nil {
+		return "", "", fmt.Errorf("the selector must be a JSON object: %v", err)
+	}
+
+	pollID, ok := selector["PollID"].(string)
+	if !ok || pollID == "" {
+		return "", "", fmt.Errorf("the selector must set PollID to the ID of a poll")
+	}
+
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"$and": []interface{}{
+				map[string]interface{}{"docType": voteObjectType},
+				selector,
+			},
+		},
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(queryJSON), pollID, nil
+}
+
+// assertQueryNotTooNarrow returns an error when a query matched some votes,
+// but fewer than the k-anonymity threshold of the given poll.
+func assertQueryNotTooNarrow(poll *Poll, matched int) error {
+	k := pollMinCellSize(poll)
+	if matched > 0 && matched < k {
+		return fmt.Errorf("the query matches fewer than %d votes and is withheld to protect respondents", k)
+	}
+
+	return nil
 }
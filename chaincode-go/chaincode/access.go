@@ -0,0 +1,31 @@
+package chaincode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// roleAttribute is the certificate attribute, issued by the Fabric CA, that
+// carries the e-voting role of a client identity.
+const roleAttribute = "evoting.role"
+
+// Roles a client identity can hold through the evoting.role attribute.
+const (
+	RoleResearcher = "researcher"
+	RoleVoter      = "voter"
+	RoleAuditor    = "auditor"
+	RoleAdmin      = "admin"
+)
+
+// assertRole returns an error unless the submitting client holds one of the given roles.
+func assertRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	for _, role := range roles {
+		if ctx.GetClientIdentity().AssertAttributeValue(roleAttribute, role) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the client identity requires the %s attribute to be one of: %s", roleAttribute, strings.Join(roles, ", "))
+}
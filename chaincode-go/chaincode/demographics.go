@@ -0,0 +1,205 @@
+package chaincode
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultAgeBands are the lower bounds of the age bands votes are grouped
+// into: under 18, 18-24, 25-34, 35-44, 45-54, 55-64 and 65+.
+var defaultAgeBands = []int{18, 25, 35, 45, 55, 65}
+
+// defaultMinCellSize is the k-anonymity threshold applied to polls that do
+// not set their own: no published cell may describe fewer than this many voters.
+const defaultMinCellSize = 5
+
+// mergedGroup is the group that demographic groups with too few voters are merged into.
+const mergedGroup = "Merged small groups"
+
+// ageBandUnknown is the band of ages that are missing or not a number.
+const ageBandUnknown = "Unknown"
+
+// Demographic dimensions results can be broken down by.
+const (
+	DimensionAge        = "Age"
+	DimensionGender     = "Gender"
+	DimensionOccupation = "Occupation"
+	DimensionCountry    = "Country"
+)
+
+// pollAgeBands returns the age bands of the given poll.
+func pollAgeBands(poll *Poll) []int {
+	if len(poll.AgeBands) == 0 {
+		return defaultAgeBands
+	}
+
+	return poll.AgeBands
+}
+
+// dimensionGroup returns the canonical name of the given dimension, matched
+// case-insensitively, and a function returning the group a vote falls in.
+func dimensionGroup(dimension string, poll *Poll) (string, func(*Vote) string, error) {
+	switch strings.ToLower(dimension) {
+	case "age":
+		bands := pollAgeBands(poll)
+		return DimensionAge, func(vote *Vote) string { return ageBand(vote.Age, bands) }, nil
+	case "gender":
+		return DimensionGender, func(vote *Vote) string { return vote.Gender }, nil
+	case "occupation":
+		return DimensionOccupation, func(vote *Vote) string { return vote.Occupation }, nil
+	case "country":
+		return DimensionCountry, func(vote *Vote) string { return vote.Country }, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown dimension %q, expected one of %s, %s, %s or %s", dimension, DimensionAge, DimensionGender, DimensionOccupation, DimensionCountry)
+}
+
+// ageBand returns the label of the band the given age falls in, where bands
+// holds the ascending lower bound of each band.
+func ageBand(age string, bands []int) string {
+	years, err := strconv.Atoi(age)
+	if err != nil || years < 0 || len(bands) == 0 {
+		return ageBandUnknown
+	}
+	if years < bands[0] {
+		return fmt.Sprintf("Under %d", bands[0])
+	}
+
+	for i := 1; i < len(bands); i++ {
+		if years < bands[i] {
+			return fmt.Sprintf("%d-%d", bands[i-1], bands[i]-1)
+		}
+	}
+
+	return fmt.Sprintf("%d+", bands[len(bands)-1])
+}
+
+// pollMinCellSize returns the k-anonymity threshold of the given poll.
+func pollMinCellSize(poll *Poll) int {
+	if poll.MinCellSize == 0 {
+		return defaultMinCellSize
+	}
+
+	return poll.MinCellSize
+}
+
+// suppressSmallCells enforces the k-anonymity threshold k on a cross-tab.
+// Groups with fewer than k voters are merged together, and the merged group
+// absorbs the next smallest groups until it reaches k. Within the remaining
+// groups, every count between 1 and k-1 is suppressed, along with enough
+// further cells that no suppressed count can be recovered by subtracting the
+// visible counts from a group total or from the overall tally of an answer.
+func suppressSmallCells(crossTab *CrossTab, k int) {
+	crossTab.MinCellSize = k
+
+	groups := crossTab.Groups
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Total < groups[j].Total
+	})
+
+	var merged *CrossTabGroup
+	for len(groups) > 0 && (groups[0].Total < k || (merged != nil && merged.Total < k)) {
+		if merged == nil {
+			merged = &CrossTabGroup{Group: mergedGroup, Counts: make(map[string]int)}
+		}
+		for value, count := range groups[0].Counts {
+			merged.Counts[value] += count
+		}
+		merged.Total += groups[0].Total
+		groups = groups[1:]
+	}
+
+	kept := append([]*CrossTabGroup{}, groups...)
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Group < kept[j].Group
+	})
+	if merged != nil {
+		if merged.Total >= k {
+			kept = append(kept, merged)
+		} else {
+			crossTab.SuppressedVoters = merged.Total
+		}
+	}
+
+	suppressed := make(map[*CrossTabGroup]map[string]bool)
+	var values []string
+	for _, group := range kept {
+		suppressed[group] = make(map[string]bool)
+		for value, count := range group.Counts {
+			if count > 0 && count < k {
+				suppressed[group][value] = true
+			}
+			if !containsString(values, value) {
+				values = append(values, value)
+			}
+		}
+	}
+	sort.Strings(values)
+
+	// A lone suppressed cell in a row or column can be recovered from the
+	// totals, so keep suppressing the smallest visible neighbour until no row
+	// or column has exactly one suppressed cell.
+	for changed := true; changed; {
+		changed = false
+		for _, group := range kept {
+			var row []crossTabCell
+			for _, value := range values {
+				row = append(row, crossTabCell{group, value})
+			}
+			if suppressLoneCell(suppressed, row) {
+				changed = true
+			}
+		}
+		for _, value := range values {
+			var column []crossTabCell
+			for _, group := range kept {
+				column = append(column, crossTabCell{group, value})
+			}
+			if suppressLoneCell(suppressed, column) {
+				changed = true
+			}
+		}
+	}
+
+	for _, group := range kept {
+		for _, value := range values {
+			if suppressed[group][value] {
+				delete(group.Counts, value)
+				group.Suppressed = append(group.Suppressed, value)
+			}
+		}
+	}
+
+	crossTab.Groups = kept
+}
+
+// crossTabCell identifies the count of one answer within one group of a cross-tab.
+type crossTabCell struct {
+	group *CrossTabGroup
+	value string
+}
+
+// suppressLoneCell suppresses the smallest visible cell of a row or column
+// when exactly one of its cells is suppressed. It returns true when a cell
+// was suppressed.
+func suppressLoneCell(suppressed map[*CrossTabGroup]map[string]bool, cells []crossTabCell) bool {
+	count := 0
+	smallest := -1
+	for i, cell := range cells {
+		if suppressed[cell.group][cell.value] {
+			count++
+			continue
+		}
+		if smallest < 0 || cell.group.Counts[cell.value] < cells[smallest].group.Counts[cells[smallest].value] {
+			smallest = i
+		}
+	}
+	if count != 1 || smallest < 0 {
+		return false
+	}
+
+	suppressed[cells[smallest].group][cells[smallest].value] = true
+	return true
+}
@@ -0,0 +1,180 @@
+package chaincode
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newCrossTabGroup returns a cross-tab group with the given counts and their total.
+func newCrossTabGroup(name string, counts map[string]int) *CrossTabGroup {
+	group := &CrossTabGroup{Group: name, Counts: counts}
+	for _, count := range counts {
+		group.Total += count
+	}
+	return group
+}
+
+func TestSuppressSmallCells(t *testing.T) {
+	tests := []struct {
+		name             string
+		groups           []*CrossTabGroup
+		groupNames       []string
+		suppressed       map[string][]string
+		suppressedVoters int
+	}{
+		{
+			name: "no small cells",
+			groups: []*CrossTabGroup{
+				newCrossTabGroup("B", map[string]int{"yes": 6, "no": 7}),
+				newCrossTabGroup("A", map[string]int{"yes": 10, "no": 8}),
+			},
+			groupNames: []string{"A", "B"},
+			suppressed: map[string][]string{},
+		},
+		{
+			name: "small groups merged",
+			groups: []*CrossTabGroup{
+				newCrossTabGroup("A", map[string]int{"yes": 10, "no": 10}),
+				newCrossTabGroup("B", map[string]int{"yes": 5, "no": 5}),
+				newCrossTabGroup("C", map[string]int{"yes": 3}),
+				newCrossTabGroup("D", map[string]int{"yes": 2, "no": 1}),
+			},
+			groupNames: []string{"A", "B", mergedGroup},
+			suppressed: map[string][]string{"B": {"no", "yes"}, mergedGroup: {"no", "yes"}},
+		},
+		{
+			name: "merged group absorbs the next smallest group",
+			groups: []*CrossTabGroup{
+				newCrossTabGroup("A", map[string]int{"yes": 10, "no": 10}),
+				newCrossTabGroup("B", map[string]int{"yes": 6}),
+				newCrossTabGroup("C", map[string]int{"yes": 3}),
+			},
+			groupNames: []string{"A", mergedGroup},
+			suppressed: map[string][]string{},
+		},
+		{
+			name: "small groups absorb a large group to reach the threshold",
+			groups: []*CrossTabGroup{
+				newCrossTabGroup("A", map[string]int{"yes": 10, "no": 10}),
+				newCrossTabGroup("B", map[string]int{"yes": 1}),
+				newCrossTabGroup("C", map[string]int{"no": 2}),
+			},
+			groupNames: []string{mergedGroup},
+			suppressed: map[string][]string{},
+		},
+		{
+			name: "too few voters to merge",
+			groups: []*CrossTabGroup{
+				newCrossTabGroup("B", map[string]int{"yes": 1}),
+				newCrossTabGroup("C", map[string]int{"no": 2}),
+			},
+			groupNames:       nil,
+			suppressed:       map[string][]string{},
+			suppressedVoters: 3,
+		},
+		{
+			name: "complementary suppression",
+			groups: []*CrossTabGroup{
+				newCrossTabGroup("A", map[string]int{"yes": 3, "no": 10, "maybe": 7}),
+				newCrossTabGroup("B", map[string]int{"yes": 8, "no": 9, "maybe": 6}),
+				newCrossTabGroup("C", map[string]int{"yes": 12, "no": 5, "maybe": 9}),
+			},
+			groupNames: []string{"A", "B", "C"},
+			suppressed: map[string][]string{"A": {"maybe", "yes"}, "B": {"maybe", "yes"}},
+		},
+		{
+			name: "small cells of the merged group",
+			groups: []*CrossTabGroup{
+				newCrossTabGroup("A", map[string]int{"yes": 10, "no": 10}),
+				newCrossTabGroup("B", map[string]int{"yes": 2, "no": 1}),
+				newCrossTabGroup("C", map[string]int{"yes": 1, "no": 2}),
+			},
+			groupNames: []string{"A", mergedGroup},
+			suppressed: map[string][]string{"A": {"no", "yes"}, mergedGroup: {"no", "yes"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crossTab := &CrossTab{Groups: test.groups}
+			suppressSmallCells(crossTab, 5)
+
+			if crossTab.MinCellSize != 5 {
+				t.Errorf("MinCellSize is %d, expected 5", crossTab.MinCellSize)
+			}
+			if crossTab.SuppressedVoters != test.suppressedVoters {
+				t.Errorf("SuppressedVoters is %d, expected %d", crossTab.SuppressedVoters, test.suppressedVoters)
+			}
+
+			var groupNames []string
+			for _, group := range crossTab.Groups {
+				groupNames = append(groupNames, group.Group)
+				if group.Total < 5 {
+					t.Errorf("the group %s has %d voters", group.Group, group.Total)
+				}
+				for value, count := range group.Counts {
+					if count > 0 && count < 5 {
+						t.Errorf("the count %d of %q in group %s is shown", count, value, group.Group)
+					}
+				}
+				if !reflect.DeepEqual(group.Suppressed, test.suppressed[group.Group]) {
+					t.Errorf("suppressed %v in group %s, expected %v", group.Suppressed, group.Group, test.suppressed[group.Group])
+				}
+			}
+			if !reflect.DeepEqual(groupNames, test.groupNames) {
+				t.Errorf("groups %v, expected %v", groupNames, test.groupNames)
+			}
+
+			assertNoLoneSuppressedCell(t, crossTab)
+		})
+	}
+}
+
+// assertNoLoneSuppressedCell fails the test if a row or column of the
+// cross-tab has exactly one suppressed cell, whose count could then be
+// derived from the group total or the overall tally of the answer.
+func assertNoLoneSuppressedCell(t *testing.T, crossTab *CrossTab) {
+	columns := make(map[string]int)
+	for _, group := range crossTab.Groups {
+		if len(group.Suppressed) == 1 {
+			t.Errorf("the group %s has a single suppressed count", group.Group)
+		}
+		for _, value := range group.Suppressed {
+			columns[value]++
+		}
+	}
+	for value, count := range columns {
+		if count == 1 {
+			t.Errorf("the answer %q has a single suppressed count", value)
+		}
+	}
+}
+
+func TestAssertQueryNotTooNarrow(t *testing.T) {
+	tests := []struct {
+		name        string
+		minCellSize int
+		matched     int
+		valid       bool
+	}{
+		{"no match", 0, 0, true},
+		{"below default threshold", 0, 4, false},
+		{"at default threshold", 0, defaultMinCellSize, true},
+		{"below poll threshold", 10, 9, false},
+		{"at poll threshold", 10, 10, true},
+		{"above poll threshold", 10, 25, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			poll := &Poll{ID: "1", MinCellSize: test.minCellSize}
+			err := assertQueryNotTooNarrow(poll, test.matched)
+			if test.valid && err != nil {
+				t.Errorf("expected the query to be allowed: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected the query to be withheld")
+			}
+		})
+	}
+}
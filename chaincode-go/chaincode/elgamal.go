@@ -0,0 +1,359 @@
+package chaincode
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Ballots of homomorphic polls are encrypted with exponential ElGamal on the
+// NIST P-256 curve. Each trustee of the poll holds a private key x_i with
+// public key Y_i = x_i*G, and ballots are encrypted under the joint key
+// Y = sum(Y_i), so the answers can only be decrypted with every trustee's help.
+//
+// A choice m (0 or 1) is encrypted with a random r as A = r*G, B = m*G + r*Y.
+// Ciphertexts are added point-wise, so the sum of every ballot's ciphertext
+// for an option encrypts the number of voters who chose it, and the chaincode
+// tallies a poll without decrypting any individual ballot.
+//
+// Points are hex-encoded in uncompressed form and scalars as hex-encoded
+// big-endian integers. Proofs are non-interactive Chaum-Pedersen proofs whose
+// challenge is the SHA-256 hash, reduced modulo the curve order, of the proof
+// context followed by the uncompressed encoding of every point listed for
+// that proof, see dleqChallenge.
+
+// curve is the elliptic curve used by homomorphic polls.
+var curve = elliptic.P256()
+
+// Ciphertext is an exponential ElGamal ciphertext.
+type Ciphertext struct {
+	A string `json:"A"`
+	B string `json:"B"`
+}
+
+// DLEQProof proves that log_G1(H1) = log_G2(H2) without revealing the
+// logarithm. With commitments a1 = Z*G1 - C*H1 and a2 = Z*G2 - C*H2, the
+// challenge C must equal the hash of the context, G1, H1, G2, H2, a1 and a2.
+type DLEQProof struct {
+	C string `json:"C"`
+	Z string `json:"Z"`
+}
+
+// BitProof proves that a ciphertext (A, B) encrypts 0 or 1. It holds one
+// DLEQ proof of log_G(A) = log_Y(B - j*G) for each j in {0, 1}, one of them
+// simulated, with commitments a_j = Zj*G - Cj*A and b_j = Zj*Y - Cj*(B - j*G).
+// C0 + C1 must equal the hash of the context, Y, A, B, a0, b0, a1 and b1.
+type BitProof struct {
+	C0 string `json:"C0"`
+	C1 string `json:"C1"`
+	Z0 string `json:"Z0"`
+	Z1 string `json:"Z1"`
+}
+
+// EncryptedChoice is the encrypted choice of a single option or scale point.
+// The proof context is "<pollID>|<questionID>|<option>".
+type EncryptedChoice struct {
+	Option     string     `json:"Option"`
+	Ciphertext Ciphertext `json:"Ciphertext"`
+	Proof      BitProof   `json:"Proof"`
+}
+
+// EncryptedAnswer is the answer to a question of a homomorphic poll, passed
+// as JSON in place of a plain answer on a ballot. It holds one choice for
+// every option or scale point of the question, in order. For single choice
+// and Likert questions, SumProof proves that the sum of the choices encrypts
+// exactly 1, i.e. log_G(sum A) = log_Y(sum B - G), with the proof context
+// "<pollID>|<questionID>|sum".
+type EncryptedAnswer struct {
+	Choices  []EncryptedChoice `json:"Choices"`
+	SumProof *DLEQProof        `json:"SumProof,omitempty"`
+}
+
+// Trustee is a key holder of a homomorphic poll. Proof proves knowledge of the
+// private key as log_G(PublicKey) = log_G(PublicKey), with the proof context
+// "<pollID>|trustee".
+type Trustee struct {
+	PublicKey string    `json:"PublicKey"`
+	Proof     DLEQProof `json:"Proof"`
+}
+
+// DecryptionShare is a trustee's share of the decryption of an option's
+// tallied ciphertext (A, B): Share = x_i*A. Proof proves log_G(Y_i) =
+// log_A(Share), with the proof context "<pollID>|<questionID>|<option>|decrypt".
+type DecryptionShare struct {
+	QuestionID string    `json:"QuestionID"`
+	Option     string    `json:"Option"`
+	Share      string    `json:"Share"`
+	Proof      DLEQProof `json:"Proof"`
+}
+
+// point is a point on the curve; the point at infinity is (0, 0).
+type point struct {
+	x, y *big.Int
+}
+
+// generator returns the base point of the curve.
+func generator() *point {
+	return &point{curve.Params().Gx, curve.Params().Gy}
+}
+
+// decodePoint parses a hex-encoded uncompressed curve point.
+func decodePoint(s string) (*point, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed point %q: %v", s, err)
+	}
+
+	x, y := elliptic.Unmarshal(curve, data)
+	if x == nil {
+		return nil, fmt.Errorf("malformed point %q: not on curve P-256", s)
+	}
+
+	return &point{x, y}, nil
+}
+
+// encode returns the hex-encoded uncompressed form of the point.
+func (p *point) encode() string {
+	return hex.EncodeToString(elliptic.Marshal(curve, p.x, p.y))
+}
+
+// isInfinity returns true for the point at infinity.
+func (p *point) isInfinity() bool {
+	return p.x.Sign() == 0 && p.y.Sign() == 0
+}
+
+func (p *point) add(q *point) *point {
+	x, y := curve.Add(p.x, p.y, q.x, q.y)
+	return &point{x, y}
+}
+
+func (p *point) sub(q *point) *point {
+	if q.isInfinity() {
+		return p
+	}
+	return p.add(&point{q.x, new(big.Int).Sub(curve.Params().P, q.y)})
+}
+
+func (p *point) mul(k *big.Int) *point {
+	x, y := curve.ScalarMult(p.x, p.y, new(big.Int).Mod(k, curve.Params().N).Bytes())
+	return &point{x, y}
+}
+
+// decodeScalar parses a hex-encoded scalar smaller than the curve order.
+func decodeScalar(s string) (*big.Int, error) {
+	k, ok := new(big.Int).SetString(s, 16)
+	if !ok || k.Sign() < 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("malformed scalar %q", s)
+	}
+
+	return k, nil
+}
+
+// decodeCiphertext parses both points of a ciphertext.
+func decodeCiphertext(ciphertext Ciphertext) (*point, *point, error) {
+	a, err := decodePoint(ciphertext.A)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := decodePoint(ciphertext.B)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return a, b, nil
+}
+
+// dleqChallenge returns the Fiat-Shamir challenge for the given proof context and points.
+func dleqChallenge(context string, points ...*point) *big.Int {
+	hash := sha256.New()
+	hash.Write([]byte(context))
+	for _, p := range points {
+		hash.Write(elliptic.Marshal(curve, p.x, p.y))
+	}
+
+	c := new(big.Int).SetBytes(hash.Sum(nil))
+	return c.Mod(c, curve.Params().N)
+}
+
+// verifyDLEQ returns true when the proof shows that log_g1(h1) = log_g2(h2).
+func verifyDLEQ(context string, g1, h1, g2, h2 *point, proof DLEQProof) bool {
+	c, err := decodeScalar(proof.C)
+	if err != nil {
+		return false
+	}
+	z, err := decodeScalar(proof.Z)
+	if err != nil {
+		return false
+	}
+
+	a1 := g1.mul(z).sub(h1.mul(c))
+	a2 := g2.mul(z).sub(h2.mul(c))
+
+	return dleqChallenge(context, g1, h1, g2, h2, a1, a2).Cmp(c) == 0
+}
+
+// verifyBit returns true when the proof shows that (a, b) encrypts 0 or 1 under key y.
+func verifyBit(context string, y, a, b *point, proof BitProof) bool {
+	scalars := make([]*big.Int, 4)
+	for i, s := range []string{proof.C0, proof.C1, proof.Z0, proof.Z1} {
+		k, err := decodeScalar(s)
+		if err != nil {
+			return false
+		}
+		scalars[i] = k
+	}
+	c0, c1, z0, z1 := scalars[0], scalars[1], scalars[2], scalars[3]
+
+	g := generator()
+	a0 := g.mul(z0).sub(a.mul(c0))
+	b0 := y.mul(z0).sub(b.mul(c0))
+	a1 := g.mul(z1).sub(a.mul(c1))
+	b1 := y.mul(z1).sub(b.sub(g).mul(c1))
+
+	c := new(big.Int).Add(c0, c1)
+	c.Mod(c, curve.Params().N)
+
+	return dleqChallenge(context, y, a, b, a0, b0, a1, b1).Cmp(c) == 0
+}
+
+// pollPublicKey returns the joint public key of the trustees of the given poll.
+func pollPublicKey(poll *Poll) (*point, error) {
+	if len(poll.Trustees) == 0 {
+		return nil, fmt.Errorf("the poll %s has no trustees", poll.ID)
+	}
+
+	key := &point{new(big.Int), new(big.Int)}
+	for _, trustee := range poll.Trustees {
+		y, err := decodePoint(trustee)
+		if err != nil {
+			return nil, err
+		}
+		key = key.add(y)
+	}
+	if key.isInfinity() {
+		return nil, fmt.Errorf("the trustee keys of poll %s cancel out", poll.ID)
+	}
+
+	return key, nil
+}
+
+// encryptedOptions returns the options or scale points a question's
+// encrypted answers hold a choice for, or an error if the question cannot be
+// answered in a homomorphic poll.
+func encryptedOptions(question *Question) ([]string, error) {
+	switch question.Type {
+	case QuestionTypeSingleChoice, QuestionTypeMultipleChoice:
+		return question.Options, nil
+	case QuestionTypeLikert:
+		var points []string
+		for value := question.Min; value <= question.Max; value++ {
+			points = append(points, strconv.Itoa(value))
+		}
+		return points, nil
+	default:
+		return nil, fmt.Errorf("the %s question %s cannot be encrypted", question.Type, question.ID)
+	}
+}
+
+// parseEncryptedAnswer parses and verifies an encrypted answer to the given
+// question of the given poll, and returns its ciphertexts in option order.
+func parseEncryptedAnswer(poll *Poll, question *Question, value string) ([][2]*point, error) {
+	options, err := encryptedOptions(question)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := pollPublicKey(poll)
+	if err != nil {
+		return nil, err
+	}
+
+	var answer EncryptedAnswer
+	err = json.Unmarshal([]byte(value), &answer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted answer to question %s: %v", question.ID, err)
+	}
+	if len(answer.Choices) != len(options) {
+		return nil, fmt.Errorf("the encrypted answer to question %s must hold %d choices", question.ID, len(options))
+	}
+
+	g := generator()
+	sumA := &point{new(big.Int), new(big.Int)}
+	sumB := &point{new(big.Int), new(big.Int)}
+	ciphertexts := make([][2]*point, len(options))
+	for i, choice := range answer.Choices {
+		if choice.Option != options[i] {
+			return nil, fmt.Errorf("choice %d of the encrypted answer to question %s must be for %q", i, question.ID, options[i])
+		}
+
+		a, b, err := decodeCiphertext(choice.Ciphertext)
+		if err != nil {
+			return nil, err
+		}
+
+		context := fmt.Sprintf("%s|%s|%s", poll.ID, question.ID, choice.Option)
+		if !verifyBit(context, y, a, b, choice.Proof) {
+			return nil, fmt.Errorf("invalid proof for choice %q of question %s", choice.Option, question.ID)
+		}
+
+		ciphertexts[i] = [2]*point{a, b}
+		sumA = sumA.add(a)
+		sumB = sumB.add(b)
+	}
+
+	if question.Type != QuestionTypeMultipleChoice {
+		if answer.SumProof == nil {
+			return nil, fmt.Errorf("the encrypted answer to question %s needs a proof that exactly one choice is made", question.ID)
+		}
+
+		context := fmt.Sprintf("%s|%s|sum", poll.ID, question.ID)
+		if !verifyDLEQ(context, g, sumA, y, sumB.sub(g), *answer.SumProof) {
+			return nil, fmt.Errorf("invalid sum proof for question %s", question.ID)
+		}
+	}
+
+	return ciphertexts, nil
+}
+
+// checkPollEncryptable returns an error unless the given homomorphic poll
+// has trustees and only questions whose answers can be encrypted.
+func checkPollEncryptable(ctx contractapi.TransactionContextInterface, poll *Poll) error {
+	_, err := pollPublicKey(poll)
+	if err != nil {
+		return err
+	}
+
+	questions, err := getPollQuestions(ctx, poll.ID)
+	if err != nil {
+		return err
+	}
+	for _, question := range questions {
+		_, err = encryptedOptions(question)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// discreteLog returns m in [0, max] such that p = m*G.
+func discreteLog(p *point, max int) (int, error) {
+	g := generator()
+	candidate := &point{new(big.Int), new(big.Int)}
+	for m := 0; m <= max; m++ {
+		if candidate.x.Cmp(p.x) == 0 && candidate.y.Cmp(p.y) == 0 {
+			return m, nil
+		}
+		candidate = candidate.add(g)
+	}
+
+	return 0, fmt.Errorf("the decrypted count is not between 0 and %d", max)
+}
@@ -0,0 +1,210 @@
+package chaincode
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+// The provers below follow the construction described on DLEQProof and
+// BitProof, as a voter's or trustee's client would.
+
+func randomScalar(t *testing.T) *big.Int {
+	k, err := rand.Int(rand.Reader, curve.Params().N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func scalarHex(k *big.Int) string {
+	return new(big.Int).Mod(k, curve.Params().N).Text(16)
+}
+
+// proveDLEQ proves that h1 = x*g1 and h2 = x*g2.
+func proveDLEQ(t *testing.T, context string, g1, h1, g2, h2 *point, x *big.Int) DLEQProof {
+	w := randomScalar(t)
+	c := dleqChallenge(context, g1, h1, g2, h2, g1.mul(w), g2.mul(w))
+	z := new(big.Int).Add(w, new(big.Int).Mul(c, x))
+	return DLEQProof{C: scalarHex(c), Z: scalarHex(z)}
+}
+
+// encryptBit encrypts m under key y and proves that m is 0 or 1, returning
+// the ciphertext, the proof and the randomness used. The proof for the other
+// value is simulated.
+func encryptBit(t *testing.T, context string, y *point, m int) (*point, *point, BitProof, *big.Int) {
+	g := generator()
+	n := curve.Params().N
+	r := randomScalar(t)
+	a := g.mul(r)
+	b := y.mul(r)
+	if m == 1 {
+		b = b.add(g)
+	}
+
+	// commitments a_j = Zj*G - Cj*A and b_j = Zj*Y - Cj*(B - j*G)
+	c := make([]*big.Int, 2)
+	z := make([]*big.Int, 2)
+	commitA := make([]*point, 2)
+	commitB := make([]*point, 2)
+	shift := []*point{b, b.sub(g)}
+
+	other := 1 - m
+	c[other], z[other] = randomScalar(t), randomScalar(t)
+	commitA[other] = g.mul(z[other]).sub(a.mul(c[other]))
+	commitB[other] = y.mul(z[other]).sub(shift[other].mul(c[other]))
+
+	w := randomScalar(t)
+	commitA[m], commitB[m] = g.mul(w), y.mul(w)
+
+	challenge := dleqChallenge(context, y, a, b, commitA[0], commitB[0], commitA[1], commitB[1])
+	c[m] = new(big.Int).Sub(challenge, c[other])
+	c[m].Mod(c[m], n)
+	z[m] = new(big.Int).Add(w, new(big.Int).Mul(c[m], r))
+
+	return a, b, BitProof{C0: scalarHex(c[0]), C1: scalarHex(c[1]), Z0: scalarHex(z[0]), Z1: scalarHex(z[1])}, r
+}
+
+func TestVerifyDLEQ(t *testing.T) {
+	g := generator()
+	x := randomScalar(t)
+	g2 := g.mul(randomScalar(t))
+	h1, h2 := g.mul(x), g2.mul(x)
+	proof := proveDLEQ(t, "ctx", g, h1, g2, h2, x)
+
+	tests := []struct {
+		name    string
+		context string
+		h2      *point
+		proof   DLEQProof
+		valid   bool
+	}{
+		{"valid", "ctx", h2, proof, true},
+		{"other context", "other", h2, proof, false},
+		{"unequal logarithms", "ctx", h2.add(g), proof, false},
+		{"altered challenge", "ctx", h2, DLEQProof{C: scalarHex(new(big.Int).Add(randomScalar(t), big.NewInt(1))), Z: proof.Z}, false},
+		{"altered response", "ctx", h2, DLEQProof{C: proof.C, Z: scalarHex(randomScalar(t))}, false},
+		{"malformed scalar", "ctx", h2, DLEQProof{C: "xyz", Z: proof.Z}, false},
+		{"scalar out of range", "ctx", h2, DLEQProof{C: proof.C, Z: curve.Params().N.Text(16)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if verifyDLEQ(test.context, g, h1, g2, test.h2, test.proof) != test.valid {
+				t.Errorf("expected the proof to be valid: %v", test.valid)
+			}
+		})
+	}
+}
+
+func TestVerifyBit(t *testing.T) {
+	g := generator()
+	y := g.mul(randomScalar(t))
+	a0, b0, proof0, _ := encryptBit(t, "ctx", y, 0)
+	a1, b1, proof1, _ := encryptBit(t, "ctx", y, 1)
+
+	// a proof that 1 is a bit, passed off for an encryption of 2
+	b2 := b1.add(g)
+
+	swapped := proof1
+	swapped.C0, swapped.C1 = proof1.C1, proof1.C0
+
+	tests := []struct {
+		name    string
+		context string
+		a, b    *point
+		proof   BitProof
+		valid   bool
+	}{
+		{"zero", "ctx", a0, b0, proof0, true},
+		{"one", "ctx", a1, b1, proof1, true},
+		{"other context", "other", a1, b1, proof1, false},
+		{"proof of another ciphertext", "ctx", a0, b0, proof1, false},
+		{"encryption of two", "ctx", a1, b2, proof1, false},
+		{"swapped challenges", "ctx", a1, b1, swapped, false},
+		{"malformed scalar", "ctx", a0, b0, BitProof{C0: proof0.C0, C1: proof0.C1, Z0: "-1", Z1: proof0.Z1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if verifyBit(test.context, y, test.a, test.b, test.proof) != test.valid {
+				t.Errorf("expected the proof to be valid: %v", test.valid)
+			}
+		})
+	}
+}
+
+func TestParseEncryptedAnswer(t *testing.T) {
+	g := generator()
+	y := g.mul(randomScalar(t))
+	poll := &Poll{ID: "1", Mode: PollModeHomomorphic, Trustees: []string{y.encode()}}
+	question := &Question{ID: "1-1", PollID: "1", Type: QuestionTypeLikert, Min: 1, Max: 3}
+
+	// encryptAnswer encrypts one choice per scale point and proves that the
+	// choices add up to one, using the sum of their randomness as witness.
+	encryptAnswer := func(choices []int, options []string) EncryptedAnswer {
+		answer := EncryptedAnswer{}
+		sumA := &point{new(big.Int), new(big.Int)}
+		sumB := &point{new(big.Int), new(big.Int)}
+		sumR := new(big.Int)
+		for i, m := range choices {
+			a, b, proof, r := encryptBit(t, "1|1-1|"+options[i], y, m)
+			answer.Choices = append(answer.Choices, EncryptedChoice{
+				Option:     options[i],
+				Ciphertext: Ciphertext{A: a.encode(), B: b.encode()},
+				Proof:      proof,
+			})
+			sumA, sumB = sumA.add(a), sumB.add(b)
+			sumR.Add(sumR, r)
+		}
+
+		sumProof := proveDLEQ(t, "1|1-1|sum", g, sumA, y, sumB.sub(g), sumR)
+		answer.SumProof = &sumProof
+		return answer
+	}
+
+	scale := []string{"1", "2", "3"}
+	valid := encryptAnswer([]int{0, 1, 0}, scale)
+	tamperedChoice := encryptAnswer([]int{0, 1, 0}, scale)
+	tamperedChoice.Choices[0].Ciphertext = tamperedChoice.Choices[2].Ciphertext
+	noSumProof := encryptAnswer([]int{0, 1, 0}, scale)
+	noSumProof.SumProof = nil
+
+	tests := []struct {
+		name   string
+		answer EncryptedAnswer
+		valid  bool
+	}{
+		{"one choice", valid, true},
+		{"two choices", encryptAnswer([]int{1, 1, 0}, scale), false},
+		{"no choice", encryptAnswer([]int{0, 0, 0}, scale), false},
+		{"missing scale point", encryptAnswer([]int{0, 1}, scale[:2]), false},
+		{"options out of order", encryptAnswer([]int{0, 1, 0}, []string{"2", "1", "3"}), false},
+		{"ciphertext of another choice", tamperedChoice, false},
+		{"missing sum proof", noSumProof, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			answerJSON, err := json.Marshal(test.answer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ciphertexts, err := parseEncryptedAnswer(poll, question, string(answerJSON))
+			if !test.valid {
+				if err == nil {
+					t.Error("expected the answer to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ciphertexts) != len(scale) {
+				t.Errorf("got %d ciphertexts, expected %d", len(ciphertexts), len(scale))
+			}
+		})
+	}
+}
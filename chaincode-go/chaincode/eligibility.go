@@ -0,0 +1,101 @@
+package chaincode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Prefixes separating the leaves of an eligibility tree from its inner
+// nodes, so that an inner node can never be passed off as a voter's leaf.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleStep is one step of a Merkle inclusion proof, from the leaf up to the
+// root: the hex-encoded hash of the sibling node and whether it is the left
+// child of their parent.
+type MerkleStep struct {
+	Sibling string `json:"Sibling"`
+	Left    bool   `json:"Left"`
+}
+
+// The eligibility tree of a poll is built off-chain from the voter
+// identifiers of its panel, see voterIdentifier. Each leaf is
+// SHA-256(0x00 || identifier) and each inner node SHA-256(0x01 || left || right);
+// only the root is stored on the poll.
+
+// eligibilityLeaf returns the leaf hash of the given voter identifier.
+func eligibilityLeaf(identifier string) []byte {
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, identifier...))
+	return hash[:]
+}
+
+// merkleRoot returns the root reached by walking the given proof up from a leaf.
+func merkleRoot(leaf []byte, proof []MerkleStep) ([]byte, error) {
+	node := leaf
+	for i, step := range proof {
+		sibling, err := hex.DecodeString(step.Sibling)
+		if err != nil || len(sibling) != sha256.Size {
+			return nil, fmt.Errorf("step %d of the eligibility proof is not a hex-encoded SHA-256 hash", i)
+		}
+
+		data := []byte{merkleNodePrefix}
+		if step.Left {
+			data = append(append(data, sibling...), node...)
+		} else {
+			data = append(append(data, node...), sibling...)
+		}
+		hash := sha256.Sum256(data)
+		node = hash[:]
+	}
+
+	return node, nil
+}
+
+// assertEligible returns an error unless the submitting client is on the
+// eligibility list of the given poll. Polls without an eligibility root are
+// open to every voter. The inclusion proof is read as a JSON list of
+// MerkleStep from the "eligibility" transient field, so it does not reveal
+// other panel members on the ledger.
+func assertEligible(ctx contractapi.TransactionContextInterface, poll *Poll) error {
+	if poll.EligibilityRoot == "" {
+		return nil
+	}
+
+	identifier, err := voterIdentifier(ctx, poll.VoterAttribute)
+	if err != nil {
+		return err
+	}
+
+	proofJSON, err := transientValue(ctx, eligibilityTransientKey)
+	if err != nil {
+		return err
+	}
+
+	var proof []MerkleStep
+	err = json.Unmarshal(proofJSON, &proof)
+	if err != nil {
+		return fmt.Errorf("failed to parse eligibility proof: %v", err)
+	}
+
+	root, err := merkleRoot(eligibilityLeaf(identifier), proof)
+	if err != nil {
+		return err
+	}
+
+	expected, err := hex.DecodeString(poll.EligibilityRoot)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, expected) {
+		return fmt.Errorf("the client is not eligible to vote in poll %s", poll.ID)
+	}
+
+	return nil
+}
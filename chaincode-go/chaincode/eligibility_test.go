@@ -0,0 +1,115 @@
+package chaincode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+// eligibilityVector is a tree built by the REST server's eligibility
+// endpoint, so that both implementations are checked against the same data.
+type eligibilityVector struct {
+	Identifiers []string                `json:"Identifiers"`
+	Root        string                  `json:"Root"`
+	Proofs      map[string][]MerkleStep `json:"Proofs"`
+}
+
+func readEligibilityVectors(t *testing.T) []eligibilityVector {
+	data, err := ioutil.ReadFile("testdata/eligibility_trees.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []eligibilityVector
+	err = json.Unmarshal(data, &vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return vectors
+}
+
+func TestMerkleRootAcceptsIssuedProofs(t *testing.T) {
+	for _, vector := range readEligibilityVectors(t) {
+		expected, err := hex.DecodeString(vector.Root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, identifier := range vector.Identifiers {
+			root, err := merkleRoot(eligibilityLeaf(identifier), vector.Proofs[identifier])
+			if err != nil {
+				t.Fatalf("tree of %d: proof of %s: %v", len(vector.Identifiers), identifier, err)
+			}
+			if !bytes.Equal(root, expected) {
+				t.Errorf("tree of %d: proof of %s leads to %x, expected %s", len(vector.Identifiers), identifier, root, vector.Root)
+			}
+		}
+	}
+}
+
+func TestMerkleRootRejectsTamperedProofs(t *testing.T) {
+	vectors := readEligibilityVectors(t)
+	vector := vectors[len(vectors)-1]
+	identifier := vector.Identifiers[2]
+	proof := vector.Proofs[identifier]
+
+	tamper := func(change func([]MerkleStep) []MerkleStep) []MerkleStep {
+		return change(append([]MerkleStep{}, proof...))
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		proof      []MerkleStep
+		malformed  bool
+	}{
+		{"other identifier", "Org1MSP::mallory", proof, false},
+		{"proof of another voter", identifier, vector.Proofs[vector.Identifiers[3]], false},
+		{"flipped side", identifier, tamper(func(p []MerkleStep) []MerkleStep {
+			p[0].Left = !p[0].Left
+			return p
+		}), false},
+		{"altered sibling", identifier, tamper(func(p []MerkleStep) []MerkleStep {
+			p[1].Sibling = vector.Root
+			return p
+		}), false},
+		{"truncated", identifier, proof[:len(proof)-1], false},
+		{"extended", identifier, tamper(func(p []MerkleStep) []MerkleStep {
+			return append(p, MerkleStep{Sibling: vector.Root})
+		}), false},
+		{"skipped step", identifier, proof[1:], false},
+		{"short sibling", identifier, tamper(func(p []MerkleStep) []MerkleStep {
+			p[0].Sibling = p[0].Sibling[2:]
+			return p
+		}), true},
+		{"non-hex sibling", identifier, tamper(func(p []MerkleStep) []MerkleStep {
+			p[0].Sibling = "zz" + p[0].Sibling[2:]
+			return p
+		}), true},
+	}
+
+	expected, err := hex.DecodeString(vector.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := merkleRoot(eligibilityLeaf(test.identifier), test.proof)
+			if test.malformed {
+				if err == nil {
+					t.Error("expected a malformed proof error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(root, expected) {
+				t.Error("tampered proof leads to the eligibility root")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Names of the chaincode events emitted by the poll and ballot lifecycle.
+// Fabric delivers at most one event per transaction, named after what the
+// transaction did, with a PollEvent as its JSON payload.
+const (
+	// EventPollCreated is emitted by CreatePoll.
+	EventPollCreated = "PollCreated"
+	// EventPollOpened is emitted by OpenPoll.
+	EventPollOpened = "PollOpened"
+	// EventPollClosed is emitted by ClosePoll. Polls closing on schedule emit no event.
+	EventPollClosed = "PollClosed"
+	// EventBallotCast is emitted whenever a ballot is recorded by CastVote,
+	// CastAnonymousVote or RevealBallot.
+	EventBallotCast = "BallotCast"
+	// EventResultsPublished is emitted by PublishResults.
+	EventResultsPublished = "ResultsPublished"
+	// EventBallotSpoiled is emitted by SpoilBallot.
+	EventBallotSpoiled = "BallotSpoiled"
+	// EventBallotReplaced is emitted by ReplaceBallot instead of BallotCast.
+	EventBallotReplaced = "BallotReplaced"
+)
+
+// PollEvent is the payload of every chaincode event. TxID is the ID of the
+// emitting transaction, which for BallotCast is also the ID of the vote and
+// of its receipt; the ballot's contents are never part of an event. Status is
+// the stored status of the poll after the transaction and Timestamp the
+// transaction timestamp in RFC 3339 format.
+type PollEvent struct {
+	PollID    string `json:"PollID"`
+	Status    string `json:"Status"`
+	TxID      string `json:"TxID"`
+	Timestamp string `json:"Timestamp"`
+}
+
+// emitPollEvent sets the event of the transaction to the given event about the given poll.
+func emitPollEvent(ctx contractapi.TransactionContextInterface, name string, poll *Poll) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	event := PollEvent{
+		PollID:    poll.ID,
+		Status:    poll.Status,
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: now.UTC().Format(time.RFC3339),
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().SetEvent(name, eventJSON)
+}
@@ -0,0 +1,262 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// auditObjectType namespaces the records of who submitted each write to a
+// poll, question or result, since the history database does not keep the
+// submitting identity itself.
+const auditObjectType = "audit"
+
+// AuditRecord identifies the client that submitted a write, by MSP ID and
+// certificate subject.
+type AuditRecord struct {
+	SubmitterMSP string `json:"SubmitterMSP"`
+	Submitter    string `json:"Submitter"`
+}
+
+// PollVersion describes one version of a poll in its history. Poll is empty
+// when the version is a deletion.
+type PollVersion struct {
+	TxID         string `json:"TxID"`
+	Timestamp    string `json:"Timestamp"`
+	IsDelete     bool   `json:"IsDelete"`
+	SubmitterMSP string `json:"SubmitterMSP"`
+	Submitter    string `json:"Submitter"`
+	Poll         *Poll  `json:"Poll,omitempty"`
+}
+
+// QuestionVersion describes one version of a question in its history.
+// Question is empty when the version is a deletion.
+type QuestionVersion struct {
+	TxID         string    `json:"TxID"`
+	Timestamp    string    `json:"Timestamp"`
+	IsDelete     bool      `json:"IsDelete"`
+	SubmitterMSP string    `json:"SubmitterMSP"`
+	Submitter    string    `json:"Submitter"`
+	Question     *Question `json:"Question,omitempty"`
+}
+
+// ResultVersion describes one version of a poll's result in its history.
+type ResultVersion struct {
+	TxID         string  `json:"TxID"`
+	Timestamp    string  `json:"Timestamp"`
+	IsDelete     bool    `json:"IsDelete"`
+	SubmitterMSP string  `json:"SubmitterMSP"`
+	Submitter    string  `json:"Submitter"`
+	Result       *Result `json:"Result,omitempty"`
+}
+
+// keyVersion is one version of a world state key along with the client that wrote it.
+type keyVersion struct {
+	txID      string
+	timestamp string
+	isDelete  bool
+	audit     AuditRecord
+	value     []byte
+}
+
+// GetPollHistory returns every version of the poll with given id, including
+// its deletion, along with the transaction and client that wrote it. Like
+// ReadPoll, it is open to every client.
+func (s *PollContract) GetPollHistory(ctx contractapi.TransactionContextInterface, id string) ([]*PollVersion, error) {
+	key, err := pollKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := keyHistory(ctx, pollObjectType, id, key)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*PollVersion{}
+	for _, version := range versions {
+		pollVersion := PollVersion{
+			TxID:         version.txID,
+			Timestamp:    version.timestamp,
+			IsDelete:     version.isDelete,
+			SubmitterMSP: version.audit.SubmitterMSP,
+			Submitter:    version.audit.Submitter,
+		}
+		if !version.isDelete {
+			pollVersion.Poll = &Poll{}
+			err = json.Unmarshal(version.value, pollVersion.Poll)
+			if err != nil {
+				return nil, err
+			}
+		}
+		history = append(history, &pollVersion)
+	}
+
+	return history, nil
+}
+
+// GetQuestionHistory returns every version of the question with given id,
+// including its deletion, along with the transaction and client that wrote
+// it. Like ReadQuestion, it is open to every client.
+func (s *QuestionContract) GetQuestionHistory(ctx contractapi.TransactionContextInterface, id string) ([]*QuestionVersion, error) {
+	key, err := questionKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := keyHistory(ctx, questionObjectType, id, key)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*QuestionVersion{}
+	for _, version := range versions {
+		questionVersion := QuestionVersion{
+			TxID:         version.txID,
+			Timestamp:    version.timestamp,
+			IsDelete:     version.isDelete,
+			SubmitterMSP: version.audit.SubmitterMSP,
+			Submitter:    version.audit.Submitter,
+		}
+		if !version.isDelete {
+			questionVersion.Question = &Question{}
+			err = json.Unmarshal(version.value, questionVersion.Question)
+			if err != nil {
+				return nil, err
+			}
+		}
+		history = append(history, &questionVersion)
+	}
+
+	return history, nil
+}
+
+// GetResultHistory returns every version of the result of the given poll,
+// one for each time it was tallied or decrypted, along with the transaction
+// and client that wrote it. Like GetResults, it is restricted to
+// researchers, auditors and admins until the results are published.
+func (s *ResultContract) GetResultHistory(ctx contractapi.TransactionContextInterface, pollID string) ([]*ResultVersion, error) {
+	_, err := readResultsPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := resultKey(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := keyHistory(ctx, resultObjectType, pollID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*ResultVersion{}
+	for _, version := range versions {
+		resultVersion := ResultVersion{
+			TxID:         version.txID,
+			Timestamp:    version.timestamp,
+			IsDelete:     version.isDelete,
+			SubmitterMSP: version.audit.SubmitterMSP,
+			Submitter:    version.audit.Submitter,
+		}
+		if !version.isDelete {
+			resultVersion.Result = &Result{}
+			err = json.Unmarshal(version.value, resultVersion.Result)
+			if err != nil {
+				return nil, err
+			}
+		}
+		history = append(history, &resultVersion)
+	}
+
+	return history, nil
+}
+
+// keyHistory walks the history of the given world state key and looks up the
+// audit record of each version of the entity with given object type and id.
+func keyHistory(ctx contractapi.TransactionContextInterface, objectType string, id string, key string) ([]*keyVersion, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var versions []*keyVersion
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		version := keyVersion{
+			txID:     modification.TxId,
+			isDelete: modification.IsDelete,
+			value:    modification.Value,
+		}
+		if modification.Timestamp != nil {
+			version.timestamp = modification.Timestamp.AsTime().UTC().Format(time.RFC3339Nano)
+		}
+
+		audit, err := readAuditRecord(ctx, objectType, id, modification.TxId)
+		if err != nil {
+			return nil, err
+		}
+		if audit != nil {
+			version.audit = *audit
+		}
+
+		versions = append(versions, &version)
+	}
+
+	return versions, nil
+}
+
+// recordSubmitter stores the identity of the client writing the entity with
+// given object type and id in the current transaction.
+func recordSubmitter(ctx contractapi.TransactionContextInterface, objectType string, id string) error {
+	mspID, subject, err := clientOwner(ctx)
+	if err != nil {
+		return err
+	}
+
+	auditJSON, err := json.Marshal(AuditRecord{SubmitterMSP: mspID, Submitter: subject})
+	if err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(auditObjectType, []string{objectType, id, ctx.GetStub().GetTxID()})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, auditJSON)
+}
+
+// readAuditRecord returns the identity of the client that wrote the entity
+// with given object type and id in the given transaction, or nil for writes
+// made before submitters were recorded.
+func readAuditRecord(ctx contractapi.TransactionContextInterface, objectType string, id string, txID string) (*AuditRecord, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(auditObjectType, []string{objectType, id, txID})
+	if err != nil {
+		return nil, err
+	}
+
+	auditJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if auditJSON == nil {
+		return nil, nil
+	}
+
+	var audit AuditRecord
+	err = json.Unmarshal(auditJSON, &audit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &audit, nil
+}
@@ -0,0 +1,143 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// clientOwner returns the MSP ID and certificate subject of the submitting
+// client, which together identify the owner of a poll.
+func clientOwner(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	clientIdentity := ctx.GetClientIdentity()
+
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+
+	certificate, err := clientIdentity.GetX509Certificate()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read client certificate: %v", err)
+	}
+
+	return mspID, certificate.Subject.String(), nil
+}
+
+// voterIdentifier returns a stable identifier for the submitting client. When
+// attribute is set, the value of that certificate attribute is used so that
+// re-enrolled certificates map to the same voter; otherwise the identifier is
+// the client's MSP ID combined with its certificate ID.
+func voterIdentifier(ctx contractapi.TransactionContextInterface, attribute string) (string, error) {
+	clientIdentity := ctx.GetClientIdentity()
+
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+
+	if attribute != "" {
+		value, found, err := clientIdentity.GetAttributeValue(attribute)
+		if err != nil {
+			return "", fmt.Errorf("failed to read client attribute %s: %v", attribute, err)
+		}
+		if !found || value == "" {
+			return "", fmt.Errorf("the client identity has no %s attribute", attribute)
+		}
+		return mspID + "::" + value, nil
+	}
+
+	id, err := clientIdentity.GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client ID: %v", err)
+	}
+
+	return mspID + "::" + id, nil
+}
+
+// minSaltLength is the minimum length in bytes of a poll's voter salt. A
+// short salt could be guessed, letting anyone test whether a known identity
+// has voted.
+const minSaltLength = 16
+
+// voterHash returns the salted hash of the submitting client's voter
+// identifier for the given poll. Only this hash is ever written to the
+// ledger. The salt is secret and every poll has its own, so the hash cannot
+// be recomputed from a known identity nor matched across polls.
+func voterHash(ctx contractapi.TransactionContextInterface, poll *Poll) (string, error) {
+	identifier, err := voterIdentifier(ctx, poll.VoterAttribute)
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := readPollSalt(ctx, poll.ID)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(append(salt, identifier...))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// putPollSalt stores the voter salt passed in the transient data of the
+// transaction in the private data collection under the given poll.
+func putPollSalt(ctx contractapi.TransactionContextInterface, pollID string) error {
+	salt, err := transientValue(ctx, saltTransientKey)
+	if err != nil {
+		return err
+	}
+	if len(salt) < minSaltLength {
+		return fmt.Errorf("the salt must be at least %d bytes long", minSaltLength)
+	}
+
+	key, err := pollSaltKey(ctx, pollID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutPrivateData(ballotCollection, key, salt)
+}
+
+// readPollSalt returns the secret voter salt of the given poll.
+func readPollSalt(ctx contractapi.TransactionContextInterface, pollID string) ([]byte, error) {
+	key, err := pollSaltKey(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from private data: %v", err)
+	}
+	if salt == nil {
+		return nil, fmt.Errorf("the voter salt of poll %s does not exist", pollID)
+	}
+
+	return salt, nil
+}
+
+// markVoted records that the submitting client has voted in the given poll,
+// returning an error if it already has.
+func markVoted(ctx contractapi.TransactionContextInterface, poll *Poll) error {
+	hash, err := voterHash(ctx, poll)
+	if err != nil {
+		return err
+	}
+
+	key, err := voterKey(ctx, poll.ID, hash)
+	if err != nil {
+		return err
+	}
+
+	marker, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if marker != nil {
+		return fmt.Errorf("the client has already voted in poll %s", poll.ID)
+	}
+
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
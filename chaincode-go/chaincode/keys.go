@@ -0,0 +1,189 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object types used to namespace each entity in the world state, so that
+// e.g. question "1-1" and vote "1-1" are stored under different keys.
+const (
+	pollObjectType     = "poll"
+	questionObjectType = "question"
+	answerObjectType   = "answer"
+	voteObjectType     = "vote"
+	voterObjectType    = "voter"
+	resultObjectType   = "result"
+	receiptObjectType  = "receipt"
+	commitObjectType   = "commitment"
+	tokenObjectType    = "token"
+	ownerObjectType    = "ballotowner"
+	spoiledObjectType  = "spoiled"
+	saltObjectType     = "pollsalt"
+	issuerObjectType   = "issuerkey"
+)
+
+// ballotCollection is the private data collection holding answers and votes.
+// Peers outside the collection only see the hashes of these records, while
+// the index entries linking them to their poll and question stay public.
+const ballotCollection = "ballotCollection"
+
+// Index names of the composite keys linking a parent entity to its children.
+// Index entries carry no value; the child ID is the last key attribute.
+const (
+	pollQuestionIndex   = "poll~question"
+	questionAnswerIndex = "question~answer"
+	pollVoteIndex       = "poll~vote"
+)
+
+// pollKey returns the world state key of the poll with given id.
+func pollKey(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(pollObjectType, []string{id})
+}
+
+// questionKey returns the world state key of the question with given id.
+func questionKey(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(questionObjectType, []string{id})
+}
+
+// answerKey returns the world state key of the answer with given id.
+func answerKey(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(answerObjectType, []string{id})
+}
+
+// voteKey returns the world state key of the vote with given id.
+func voteKey(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(voteObjectType, []string{id})
+}
+
+// voterKey returns the world state key marking that the voter with given
+// salted hash has voted in the given poll.
+func voterKey(ctx contractapi.TransactionContextInterface, pollID string, voterHash string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(voterObjectType, []string{pollID, voterHash})
+}
+
+// resultKey returns the world state key of the result of the given poll.
+func resultKey(ctx contractapi.TransactionContextInterface, pollID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(resultObjectType, []string{pollID})
+}
+
+// commitmentKey returns the world state key of the ballot commitment of the
+// voter with given salted hash in the given commit-reveal poll.
+func commitmentKey(ctx contractapi.TransactionContextInterface, pollID string, voterHash string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(commitObjectType, []string{pollID, voterHash})
+}
+
+// spentTokenKey returns the world state key marking that the anonymous token
+// with given serial has been used in the given poll.
+func spentTokenKey(ctx contractapi.TransactionContextInterface, pollID string, serial string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(tokenObjectType, []string{pollID, serial})
+}
+
+// ballotOwnerKey returns the private data key of the ID of the latest ballot
+// cast by the voter with given salted hash in the given poll.
+func ballotOwnerKey(ctx contractapi.TransactionContextInterface, pollID string, voterHash string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(ownerObjectType, []string{pollID, voterHash})
+}
+
+// spoiledKey returns the world state key of the log entry marking the vote
+// with given id in the given poll as spoiled.
+func spoiledKey(ctx contractapi.TransactionContextInterface, pollID string, voteID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(spoiledObjectType, []string{pollID, voteID})
+}
+
+// pollSaltKey returns the private data key of the secret voter salt of the
+// poll with given id.
+func pollSaltKey(ctx contractapi.TransactionContextInterface, pollID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(saltObjectType, []string{pollID})
+}
+
+// issuerKeyKey returns the world state key recording which poll the token
+// issuer key with the given fingerprint is bound to.
+func issuerKeyKey(ctx contractapi.TransactionContextInterface, fingerprint string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(issuerObjectType, []string{fingerprint})
+}
+
+// receiptKey returns the world state key of the receipt of the vote cast in
+// the transaction with given id.
+func receiptKey(ctx contractapi.TransactionContextInterface, txID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(receiptObjectType, []string{txID})
+}
+
+// putIndexEntry records that the child with given id belongs to the given parent.
+func putIndexEntry(ctx contractapi.TransactionContextInterface, index string, parentID string, childID string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(index, []string{parentID, childID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
+
+// deleteIndexEntry removes the link between the given parent and child.
+func deleteIndexEntry(ctx contractapi.TransactionContextInterface, index string, parentID string, childID string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(index, []string{parentID, childID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelState(key)
+}
+
+// getIndexedIDs returns the IDs of all children of the given parent.
+func getIndexedIDs(ctx contractapi.TransactionContextInterface, index string, parentID string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, []string{parentID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(attributes) != 2 {
+			return nil, fmt.Errorf("malformed %s index key %q", index, queryResponse.Key)
+		}
+		ids = append(ids, attributes[1])
+	}
+
+	return ids, nil
+}
+
+// getIndexedIDsWithPagination returns one page of the IDs of the children of
+// the given parent, along with the bookmark of the next page and the number
+// of IDs fetched.
+func getIndexedIDsWithPagination(ctx contractapi.TransactionContextInterface, index string, parentID string, pageSize int32, bookmark string) ([]string, string, int32, error) {
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(index, []string{parentID}, pageSize, bookmark)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer resultsIterator.Close()
+
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, "", 0, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if len(attributes) != 2 {
+			return nil, "", 0, fmt.Errorf("malformed %s index key %q", index, queryResponse.Key)
+		}
+		ids = append(ids, attributes[1])
+	}
+
+	return ids, responseMetadata.Bookmark, responseMetadata.FetchedRecordsCount, nil
+}
@@ -0,0 +1,189 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// minNonceLength is the minimum length in bytes of a receipt nonce. Ballots
+// have few possible values, so a short nonce would let anyone recover a ballot
+// from its public commitment by trying every combination.
+const minNonceLength = 16
+
+// Receipt is handed to a voter when their ballot is recorded and stored on the
+// public ledger under the ID of the voting transaction. Commitment is the
+// hex-encoded SHA-256 hash of the canonical ballot JSON followed by the
+// voter's nonce, so it reveals nothing about the ballot without the nonce.
+// BlockNumber is not known to the chaincode and is filled in by the client
+// once the transaction is committed.
+type Receipt struct {
+	TxID        string `json:"TxID"`
+	PollID      string `json:"PollID"`
+	Commitment  string `json:"Commitment"`
+	BlockNumber uint64 `json:"BlockNumber,omitempty"`
+}
+
+// ReceiptStatus is the outcome of verifying a receipt. Verified is true when
+// the recorded ballot matches the receipt. A verified ballot that has since
+// been spoiled no longer counts: Spoiled is then true and ReplacedBy holds
+// the ID of the vote that replaced it, if any.
+type ReceiptStatus struct {
+	Verified   bool   `json:"Verified"`
+	Spoiled    bool   `json:"Spoiled"`
+	ReplacedBy string `json:"ReplacedBy,omitempty"`
+}
+
+// VerifyReceipt checks that the ballot recorded for the given receipt is
+// still the one the voter committed to with the given nonce, and whether it
+// has been spoiled. Only the voter knows the nonce, so nobody else can link
+// the receipt to the ballot contents. The ballot is read from the private
+// data collection, so the query must be evaluated on a peer of a collection
+// member.
+func (s *VoteContract) VerifyReceipt(ctx contractapi.TransactionContextInterface, receipt Receipt, nonce string) (*ReceiptStatus, error) {
+	stored, err := readReceipt(ctx, receipt.TxID)
+	if err != nil {
+		return nil, err
+	}
+	if stored.PollID != receipt.PollID || stored.Commitment != receipt.Commitment {
+		return &ReceiptStatus{}, nil
+	}
+
+	vote, err := readVote(ctx, receipt.TxID)
+	if err != nil {
+		return nil, err
+	}
+
+	ballot, err := recordedBallot(ctx, vote)
+	if err != nil {
+		return nil, err
+	}
+	if ballotCommitment(ballot, []byte(nonce)) != stored.Commitment {
+		return &ReceiptStatus{}, nil
+	}
+
+	status := &ReceiptStatus{Verified: true}
+	spoiled, err := readSpoiledBallot(ctx, vote.PollID, vote.ID)
+	if err != nil {
+		return nil, err
+	}
+	if spoiled != nil {
+		status.Spoiled = true
+		status.ReplacedBy = spoiled.ReplacedBy
+	}
+
+	return status, nil
+}
+
+// receiptNonce returns the nonce passed in the transient data of a vote.
+func receiptNonce(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	nonce, err := transientValue(ctx, nonceTransientKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) < minNonceLength {
+		return nil, fmt.Errorf("the nonce must be at least %d bytes long", minNonceLength)
+	}
+
+	return nonce, nil
+}
+
+// ballotCommitment returns the commitment to the given ballot and nonce. The
+// ballot is serialized with its answers ordered by question ID so that the
+// commitment does not depend on the order they were submitted in.
+func ballotCommitment(ballot *Ballot, nonce []byte) string {
+	canonical := *ballot
+	canonical.Answers = append([]BallotAnswer{}, ballot.Answers...)
+	sort.Slice(canonical.Answers, func(i, j int) bool {
+		return canonical.Answers[i].QuestionID < canonical.Answers[j].QuestionID
+	})
+
+	// Marshalling a struct of strings cannot fail.
+	ballotJSON, _ := json.Marshal(canonical)
+
+	hash := sha256.Sum256(append(ballotJSON, nonce...))
+	return hex.EncodeToString(hash[:])
+}
+
+// recordedBallot rebuilds the ballot behind the given vote from its stored
+// demographics and answers.
+func recordedBallot(ctx contractapi.TransactionContextInterface, vote *Vote) (*Ballot, error) {
+	questions, err := getPollQuestions(ctx, vote.PollID)
+	if err != nil {
+		return nil, err
+	}
+
+	ballot := Ballot{
+		Answers:    []BallotAnswer{},
+		Age:        vote.Age,
+		Gender:     vote.Gender,
+		Occupation: vote.Occupation,
+		Country:    vote.Country,
+	}
+	for _, question := range questions {
+		key, err := answerKey(ctx, fmt.Sprintf("%s-%s", question.ID, vote.ID))
+		if err != nil {
+			return nil, err
+		}
+
+		answerJSON, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from private data: %v", err)
+		}
+		if answerJSON == nil {
+			continue
+		}
+
+		var answer Answer
+		err = json.Unmarshal(answerJSON, &answer)
+		if err != nil {
+			return nil, err
+		}
+		ballot.Answers = append(ballot.Answers, BallotAnswer{QuestionID: answer.QuestionID, Answer: answer.Answer})
+	}
+
+	return &ballot, nil
+}
+
+// readReceipt returns the receipt of the vote cast in the transaction with given id.
+func readReceipt(ctx contractapi.TransactionContextInterface, txID string) (*Receipt, error) {
+	key, err := receiptKey(ctx, txID)
+	if err != nil {
+		return nil, err
+	}
+
+	receiptJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if receiptJSON == nil {
+		return nil, fmt.Errorf("the receipt %s does not exist", txID)
+	}
+
+	var receipt Receipt
+	err = json.Unmarshal(receiptJSON, &receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+// putReceipt writes the given receipt to the world state.
+func putReceipt(ctx contractapi.TransactionContextInterface, receipt *Receipt) error {
+	key, err := receiptKey(ctx, receipt.TxID)
+	if err != nil {
+		return err
+	}
+
+	receiptJSON, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, receiptJSON)
+}
@@ -0,0 +1,184 @@
+package chaincode
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// minTokenKeyBits is the minimum size of a token issuer's RSA key.
+const minTokenKeyBits = 2048
+
+// AnonymousToken proves that an eligibility token was issued for a poll
+// without revealing to whom. Serial is a random 32-byte value chosen by the
+// voter, hex-encoded, and Signature the hex-encoded RSA signature of the
+// issuer over the full-domain hash of "<pollID>|<serial>", see tokenHash.
+// The voter obtains the signature by having the issuer blind-sign
+// tokenHash*r^e mod n for a random r, then multiplies the result by r^-1, so
+// the issuer never sees the serial it signed.
+type AnonymousToken struct {
+	Serial    string `json:"Serial"`
+	Signature string `json:"Signature"`
+}
+
+// tokenHash returns the full-domain hash of a poll's token serial for the
+// given RSA modulus: the concatenation of SHA-256(counter || message) for a
+// 4-byte big-endian counter starting at 0, truncated to the length of the
+// modulus and reduced modulo it.
+func tokenHash(pollID string, serial string, n *big.Int) *big.Int {
+	message := []byte(pollID + "|" + serial)
+	size := (n.BitLen() + 7) / 8
+
+	var digest []byte
+	counter := make([]byte, 4)
+	for i := uint32(0); len(digest) < size; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		hash := sha256.Sum256(append(counter, message...))
+		digest = append(digest, hash[:]...)
+	}
+
+	m := new(big.Int).SetBytes(digest[:size])
+	return m.Mod(m, n)
+}
+
+// parseTokenIssuerKey parses a PEM-encoded RSA public key of a token issuer.
+func parseTokenIssuerKey(publicKeyPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("the token issuer key must be PEM-encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token issuer key: %v", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the token issuer key must be an RSA key")
+	}
+	if rsaKey.N.BitLen() < minTokenKeyBits {
+		return nil, fmt.Errorf("the token issuer key must be at least %d bits long", minTokenKeyBits)
+	}
+
+	return rsaKey, nil
+}
+
+// verifyToken checks the issuer's signature on the given token for the given
+// poll, and returns the token serial in canonical lower-case hex.
+func verifyToken(key *rsa.PublicKey, pollID string, token *AnonymousToken) (string, error) {
+	serialBytes, err := hex.DecodeString(token.Serial)
+	if err != nil || len(serialBytes) != 32 {
+		return "", fmt.Errorf("the token serial must be 32 hex-encoded bytes")
+	}
+	serial := hex.EncodeToString(serialBytes)
+
+	signatureBytes, err := hex.DecodeString(token.Signature)
+	if err != nil {
+		return "", fmt.Errorf("the token signature must be hex-encoded")
+	}
+
+	signature := new(big.Int).SetBytes(signatureBytes)
+	if signature.Sign() <= 0 || signature.Cmp(key.N) >= 0 {
+		return "", fmt.Errorf("invalid token signature")
+	}
+	signed := new(big.Int).Exp(signature, big.NewInt(int64(key.E)), key.N)
+	if signed.Cmp(tokenHash(pollID, serial, key.N)) != 0 {
+		return "", fmt.Errorf("invalid token signature")
+	}
+
+	return serial, nil
+}
+
+// tokenKeyFingerprint returns the hex-encoded SHA-256 hash of the modulus of
+// the given token issuer key.
+func tokenKeyFingerprint(key *rsa.PublicKey) string {
+	hash := sha256.Sum256(key.N.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+// bindTokenIssuerKey records that the given issuer key belongs to the given
+// poll, returning an error if it is already bound to another poll. Since
+// tokens are signed blindly, an issuer key shared between polls would let a
+// voter spend tokens obtained for one poll in the other.
+func bindTokenIssuerKey(ctx contractapi.TransactionContextInterface, pollID string, key *rsa.PublicKey) error {
+	bindingKey, err := issuerKeyKey(ctx, tokenKeyFingerprint(key))
+	if err != nil {
+		return err
+	}
+
+	bound, err := ctx.GetStub().GetState(bindingKey)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if bound != nil && string(bound) != pollID {
+		return fmt.Errorf("the token issuer key is already used by poll %s, every poll needs its own key", bound)
+	}
+
+	return ctx.GetStub().PutState(bindingKey, []byte(pollID))
+}
+
+// unbindTokenIssuerKey releases the issuer key of the given poll so that it
+// can be used by another poll.
+func unbindTokenIssuerKey(ctx contractapi.TransactionContextInterface, publicKeyPEM string) error {
+	key, err := parseTokenIssuerKey(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	bindingKey, err := issuerKeyKey(ctx, tokenKeyFingerprint(key))
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelState(bindingKey)
+}
+
+// spendToken verifies the anonymous token passed in the "token" transient
+// field against the issuer key of the given poll, and marks its serial as
+// spent so it cannot be used for a second ballot.
+func spendToken(ctx contractapi.TransactionContextInterface, poll *Poll) error {
+	tokenJSON, err := transientValue(ctx, tokenTransientKey)
+	if err != nil {
+		return err
+	}
+
+	var token AnonymousToken
+	err = json.Unmarshal(tokenJSON, &token)
+	if err != nil {
+		return fmt.Errorf("failed to parse token: %v", err)
+	}
+
+	key, err := parseTokenIssuerKey(poll.TokenIssuerKey)
+	if err != nil {
+		return err
+	}
+
+	serial, err := verifyToken(key, poll.ID, &token)
+	if err != nil {
+		return err
+	}
+
+	spentKey, err := spentTokenKey(ctx, poll.ID, serial)
+	if err != nil {
+		return err
+	}
+
+	marker, err := ctx.GetStub().GetState(spentKey)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if marker != nil {
+		return fmt.Errorf("the token has already been used in poll %s", poll.ID)
+	}
+
+	return ctx.GetStub().PutState(spentKey, []byte{0x00})
+}
@@ -0,0 +1,116 @@
+package chaincode
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// blindSignToken obtains the issuer's signature on a token of the given poll
+// the way a voter does: blinding the token hash, having the issuer sign it
+// and unblinding the result.
+func blindSignToken(t *testing.T, issuer *rsa.PrivateKey, pollID string, serial string) string {
+	n := issuer.N
+	r, err := rand.Int(rand.Reader, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := big.NewInt(int64(issuer.E))
+	blinded := new(big.Int).Mul(tokenHash(pollID, serial, n), new(big.Int).Exp(r, e, n))
+	blinded.Mod(blinded, n)
+
+	blindSignature := new(big.Int).Exp(blinded, issuer.D, n)
+
+	signature := new(big.Int).Mul(blindSignature, new(big.Int).ModInverse(r, n))
+	return hex.EncodeToString(signature.Mod(signature, n).Bytes())
+}
+
+func newTokenSerial(t *testing.T) string {
+	serial := make([]byte, 32)
+	if _, err := rand.Read(serial); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(serial)
+}
+
+func TestTokenHash(t *testing.T) {
+	// a 256-bit modulus takes the first SHA-256 block only
+	n := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(189))
+	block := sha256.Sum256(append([]byte{0, 0, 0, 0}, "1|ab"...))
+	expected := new(big.Int).SetBytes(block[:])
+	expected.Mod(expected, n)
+	if tokenHash("1", "ab", n).Cmp(expected) != 0 {
+		t.Errorf("the token hash of a 256-bit modulus is not the first SHA-256 block")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, minTokenKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := tokenHash("1", "ab", key.N)
+	if hash.Sign() < 0 || hash.Cmp(key.N) >= 0 {
+		t.Errorf("the token hash is not reduced modulo the key")
+	}
+	if hash.BitLen() <= 256 {
+		t.Errorf("the token hash of a %d-bit key only has %d bits", minTokenKeyBits, hash.BitLen())
+	}
+	if tokenHash("2", "ab", key.N).Cmp(hash) == 0 || tokenHash("1", "ac", key.N).Cmp(hash) == 0 {
+		t.Errorf("the token hash does not depend on both the poll and the serial")
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	issuer, err := rsa.GenerateKey(rand.Reader, minTokenKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIssuer, err := rsa.GenerateKey(rand.Reader, minTokenKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial := newTokenSerial(t)
+	signature := blindSignToken(t, issuer, "1", serial)
+	signatureValue, _ := new(big.Int).SetString(signature, 16)
+
+	tests := []struct {
+		name   string
+		pollID string
+		token  AnonymousToken
+		valid  bool
+	}{
+		{"valid", "1", AnonymousToken{Serial: serial, Signature: signature}, true},
+		{"upper-case serial", "1", AnonymousToken{Serial: strings.ToUpper(serial), Signature: signature}, true},
+		{"other poll", "2", AnonymousToken{Serial: serial, Signature: signature}, false},
+		{"other serial", "1", AnonymousToken{Serial: newTokenSerial(t), Signature: signature}, false},
+		{"other issuer", "1", AnonymousToken{Serial: serial, Signature: blindSignToken(t, otherIssuer, "1", serial)}, false},
+		{"altered signature", "1", AnonymousToken{Serial: serial, Signature: new(big.Int).Add(signatureValue, big.NewInt(1)).Text(16)}, false},
+		{"signature out of range", "1", AnonymousToken{Serial: serial, Signature: new(big.Int).Add(signatureValue, issuer.N).Text(16)}, false},
+		{"zero signature", "1", AnonymousToken{Serial: serial, Signature: "00"}, false},
+		{"non-hex signature", "1", AnonymousToken{Serial: serial, Signature: "xyz"}, false},
+		{"short serial", "1", AnonymousToken{Serial: serial[:62], Signature: signature}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spent, err := verifyToken(&issuer.PublicKey, test.pollID, &test.token)
+			if !test.valid {
+				if err == nil {
+					t.Error("expected the token to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spent != serial {
+				t.Errorf("spent serial %s, expected %s", spent, serial)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Transient fields read by the poll and vote transactions.
+const (
+	// ballotTransientKey carries a ballot as JSON.
+	ballotTransientKey = "ballot"
+	// nonceTransientKey carries the voter-held nonce committed to in a receipt.
+	nonceTransientKey = "nonce"
+	// eligibilityTransientKey carries the voter's Merkle inclusion proof.
+	eligibilityTransientKey = "eligibility"
+	// tokenTransientKey carries an anonymous eligibility token as JSON.
+	tokenTransientKey = "token"
+	// saltTransientKey carries the secret voter salt of a new poll.
+	saltTransientKey = "salt"
+)
+
+// transientValue returns the value of the given field of the transaction's
+// transient data, which is passed to the endorsers but never written to the ledger.
+func transientValue(ctx contractapi.TransactionContextInterface, field string) ([]byte, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+
+	value, ok := transientMap[field]
+	if !ok || len(value) == 0 {
+		return nil, fmt.Errorf("the %q field must be passed in the transient data", field)
+	}
+
+	return value, nil
+}
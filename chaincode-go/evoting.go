@@ -8,16 +8,32 @@ import (
 )
 
 // Create the chaincode & start it. Catch errors.
+// Each contract is registered under its own namespace, so transactions are
+// invoked as e.g. "poll:CreatePoll" or "vote:ReadVote".
 func main() {
+	pollContract := new(chaincode.PollContract)
+	pollContract.Name = "poll"
 
-	chaincode, err := contractapi.NewChaincode(new(SmartContract))
+	questionContract := new(chaincode.QuestionContract)
+	questionContract.Name = "question"
+
+	answerContract := new(chaincode.AnswerContract)
+	answerContract.Name = "answer"
+
+	voteContract := new(chaincode.VoteContract)
+	voteContract.Name = "vote"
+
+	resultContract := new(chaincode.ResultContract)
+	resultContract.Name = "result"
+
+	evotingChaincode, err := contractapi.NewChaincode(pollContract, questionContract, answerContract, voteContract, resultContract)
 
 	if err != nil {
 		log.Panicf("Error create e-voting chaincode: %s", err.Error())
 		return
 	}
 
-	if err := chaincode.Start(); err != nil {
+	if err := evotingChaincode.Start(); err != nil {
 		log.Panicf("Error starting e-voting chaincode: %s", err.Error())
 	}
 }
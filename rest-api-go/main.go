@@ -22,5 +22,12 @@ func main() {
 	if err != nil {
 		fmt.Println("Error initializing setup for Org1: ", err)
 	}
+
+	//Initialize the anonymous token issuer
+	issuer, err := web.NewTokenIssuer("issuer-keys", "eligibility.json", "issued.json")
+	if err != nil {
+		fmt.Println("Error initializing token issuer: ", err)
+	}
+	orgSetup.Issuer = issuer
 	web.Serve(web.OrgSetup(*orgSetup))
 }
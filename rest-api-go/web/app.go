@@ -18,12 +18,22 @@ type OrgSetup struct {
 	PeerEndpoint string
 	GatewayPeer  string
 	Gateway      client.Gateway
+	Issuer       *TokenIssuer
 }
 
 // Serve starts http web server.
 func Serve(setups OrgSetup) {
 	http.HandleFunc("/query", setups.Query)
 	http.HandleFunc("/invoke", setups.Invoke)
+	http.HandleFunc("/poll", setups.ReadPoll)
+	http.HandleFunc("/polls", setups.GetAllPolls)
+	http.HandleFunc("/results", setups.GetResults)
+	http.HandleFunc("/crosstab", setups.GetCrossTab)
+	http.HandleFunc("/history", setups.GetHistory)
+	http.HandleFunc("/vote", setups.CastVote)
+	http.HandleFunc("/eligibility", setups.EligibilityTree)
+	http.HandleFunc("/token", setups.IssueToken)
+	http.HandleFunc("/token/key", setups.TokenIssuerKey)
 	fmt.Println("Listening (http://localhost:3000/)...")
 	if err := http.ListenAndServe(":3000", nil); err != nil {
 		fmt.Println(err)
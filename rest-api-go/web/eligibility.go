@@ -0,0 +1,91 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// merkleStep mirrors a step of the chaincode's eligibility proofs.
+type merkleStep struct {
+	Sibling string `json:"Sibling"`
+	Left    bool   `json:"Left"`
+}
+
+// eligibilityTree describes the Merkle root of an eligibility list and the
+// inclusion proof of each voter identifier on it.
+type eligibilityTree struct {
+	Root   string                  `json:"Root"`
+	Proofs map[string][]merkleStep `json:"Proofs"`
+}
+
+// EligibilityTree handles requests to build the Merkle tree of a poll's
+// eligibility list, passed as repeated "identifier" form values. Nothing is
+// sent to the network: the researcher commits the returned root with
+// SetEligibilityRoot and hands each voter their proof.
+func (setup OrgSetup) EligibilityTree(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received EligibilityTree request")
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("ParseForm() err: %s", err), http.StatusBadRequest)
+		return
+	}
+	identifiers := r.Form["identifier"]
+	if len(identifiers) == 0 {
+		http.Error(w, "At least one identifier is required", http.StatusBadRequest)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, identifier := range identifiers {
+		if seen[identifier] {
+			http.Error(w, fmt.Sprintf("Duplicate identifier %q", identifier), http.StatusBadRequest)
+			return
+		}
+		seen[identifier] = true
+	}
+	fmt.Printf("identifiers: %d\n", len(identifiers))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildEligibilityTree(identifiers))
+}
+
+// buildEligibilityTree hashes every identifier into a leaf and pairs nodes
+// level by level; a node left without a sibling moves up unchanged.
+func buildEligibilityTree(identifiers []string) *eligibilityTree {
+	tree := &eligibilityTree{Proofs: make(map[string][]merkleStep)}
+	level := make([][]byte, len(identifiers))
+	positions := make(map[string]int)
+	for i, identifier := range identifiers {
+		leaf := sha256.Sum256(append([]byte{0x00}, identifier...))
+		level[i] = leaf[:]
+		positions[identifier] = i
+		tree.Proofs[identifier] = []merkleStep{}
+	}
+
+	for len(level) > 1 {
+		for identifier, position := range positions {
+			sibling := position ^ 1
+			if sibling < len(level) {
+				tree.Proofs[identifier] = append(tree.Proofs[identifier], merkleStep{
+					Sibling: hex.EncodeToString(level[sibling]),
+					Left:    sibling < position,
+				})
+			}
+			positions[identifier] = position / 2
+		}
+
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			node := sha256.Sum256(append(append([]byte{0x01}, level[i]...), level[i+1]...))
+			next = append(next, node[:])
+		}
+		level = next
+	}
+
+	tree.Root = hex.EncodeToString(level[0])
+	return tree
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// TestBuildEligibilityTreeMatchesChaincodeVectors checks the tree against the
+// vectors the chaincode verifies its eligibility proofs with.
+func TestBuildEligibilityTreeMatchesChaincodeVectors(t *testing.T) {
+	data, err := ioutil.ReadFile("../../chaincode-go/chaincode/testdata/eligibility_trees.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []struct {
+		Identifiers []string                `json:"Identifiers"`
+		Root        string                  `json:"Root"`
+		Proofs      map[string][]merkleStep `json:"Proofs"`
+	}
+	err = json.Unmarshal(data, &vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vector := range vectors {
+		tree := buildEligibilityTree(vector.Identifiers)
+		if tree.Root != vector.Root {
+			t.Errorf("tree of %d: root %s, expected %s", len(vector.Identifiers), tree.Root, vector.Root)
+		}
+		if !reflect.DeepEqual(tree.Proofs, vector.Proofs) {
+			t.Errorf("tree of %d: proofs differ from the chaincode vectors", len(vector.Identifiers))
+		}
+	}
+}
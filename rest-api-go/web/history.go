@@ -0,0 +1,31 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// historyFunctions maps each record type to the chaincode function returning its history.
+var historyFunctions = map[string]string{
+	"poll":     "poll:GetPollHistory",
+	"question": "question:GetQuestionHistory",
+	"result":   "result:GetResultHistory",
+}
+
+// GetHistory handles requests for every version of a poll, question or
+// result, selected by the "type" parameter. Results are looked up by poll ID.
+func (setup OrgSetup) GetHistory(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received GetHistory request")
+	queryParams := r.URL.Query()
+	chainCodeName := queryParams.Get("chaincodeid")
+	channelID := queryParams.Get("channelid")
+	recordType := queryParams.Get("type")
+	id := queryParams.Get("id")
+	function, ok := historyFunctions[recordType]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown record type %q, expected poll, question or result", recordType), http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("channel: %s, chaincode: %s, type: %s, id: %s\n", channelID, chainCodeName, recordType, id)
+	setup.evaluateJSON(w, channelID, chainCodeName, function, id)
+}
@@ -3,11 +3,15 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
 // Invoke handles chaincode invoke requests.
+// Sensitive fields, such as a ballot for CastVote, are passed as repeated
+// "transient" form values of the form key=value. They are sent to the
+// endorsing peers as transient data and never recorded in the block.
 func (setup *OrgSetup) Invoke(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received Invoke request")
 	if err := r.ParseForm(); err != nil {
@@ -18,10 +22,15 @@ func (setup *OrgSetup) Invoke(w http.ResponseWriter, r *http.Request) {
 	channelID := r.FormValue("channelid")
 	function := r.FormValue("function")
 	args := r.Form["args"]
-	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
+	transient, err := parseTransient(r.Form["transient"])
+	if err != nil {
+		fmt.Fprintf(w, "Error parsing transient data: %s", err)
+		return
+	}
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s, transient fields: %d\n", channelID, chainCodeName, function, args, len(transient))
 	network := setup.Gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
-	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...), client.WithTransient(transient))
 	if err != nil {
 		fmt.Fprintf(w, "Error creating txn proposal: %s", err)
 		return
@@ -38,3 +47,16 @@ func (setup *OrgSetup) Invoke(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Fprintf(w, "Transaction ID : %s Response: %s", txn_committed.TransactionID(), txn_endorsed.Result())
 }
+
+// parseTransient turns key=value form values into a transient data map.
+func parseTransient(fields []string) (map[string][]byte, error) {
+	transient := make(map[string][]byte, len(fields))
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("transient field %q must be of the form key=value", field)
+		}
+		transient[parts[0]] = []byte(parts[1])
+	}
+	return transient, nil
+}
@@ -0,0 +1,29 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ReadPoll handles requests for a single poll. The response is the poll as
+// JSON, including its OpensAt/ClosesAt schedule and the EffectiveStatus the
+// chaincode computed from the transaction timestamp.
+func (setup OrgSetup) ReadPoll(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received ReadPoll request")
+	queryParams := r.URL.Query()
+	chainCodeName := queryParams.Get("chaincodeid")
+	channelID := queryParams.Get("channelid")
+	id := queryParams.Get("id")
+	fmt.Printf("channel: %s, chaincode: %s, poll: %s\n", channelID, chainCodeName, id)
+	setup.evaluateJSON(w, channelID, chainCodeName, "poll:ReadPoll", id)
+}
+
+// GetAllPolls handles requests for every poll, each with its schedule and effective status.
+func (setup OrgSetup) GetAllPolls(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received GetAllPolls request")
+	queryParams := r.URL.Query()
+	chainCodeName := queryParams.Get("chaincodeid")
+	channelID := queryParams.Get("channelid")
+	fmt.Printf("channel: %s, chaincode: %s\n", channelID, chainCodeName)
+	setup.evaluateJSON(w, channelID, chainCodeName, "poll:GetAllPolls")
+}
@@ -3,9 +3,12 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 )
 
-// Query handles chaincode query requests.
+// Query handles chaincode query requests. For the paginated chaincode
+// functions, pageSize and bookmark are passed through as the last two
+// arguments; the bookmark of the next page is part of the response.
 func (setup OrgSetup) Query(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received Query request")
 	queryParams := r.URL.Query()
@@ -13,6 +16,13 @@ func (setup OrgSetup) Query(w http.ResponseWriter, r *http.Request) {
 	channelID := queryParams.Get("channelid")
 	function := queryParams.Get("function")
 	args := r.URL.Query()["args"]
+	if pageSize := queryParams.Get("pageSize"); pageSize != "" {
+		if _, err := strconv.ParseInt(pageSize, 10, 32); err != nil {
+			fmt.Fprintf(w, "Error: invalid pageSize %q", pageSize)
+			return
+		}
+		args = append(args, pageSize, queryParams.Get("bookmark"))
+	}
 	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
 	network := setup.Gateway.GetNetwork(channelID)
 	contract := network.GetContract(chainCodeName)
@@ -23,3 +33,16 @@ func (setup OrgSetup) Query(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Fprintf(w, "Response: %s", evaluateResponse)
 }
+
+// evaluateJSON evaluates a chaincode function and writes its JSON result as the response body.
+func (setup OrgSetup) evaluateJSON(w http.ResponseWriter, channelID string, chainCodeName string, function string, args ...string) {
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	evaluateResponse, err := contract.EvaluateTransaction(function, args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error: %s", err), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(evaluateResponse)
+}
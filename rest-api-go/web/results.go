@@ -0,0 +1,31 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// GetResults handles requests for the stored tally of a poll.
+func (setup OrgSetup) GetResults(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received GetResults request")
+	queryParams := r.URL.Query()
+	chainCodeName := queryParams.Get("chaincodeid")
+	channelID := queryParams.Get("channelid")
+	pollID := queryParams.Get("pollid")
+	fmt.Printf("channel: %s, chaincode: %s, poll: %s\n", channelID, chainCodeName, pollID)
+	setup.evaluateJSON(w, channelID, chainCodeName, "result:GetResults", pollID)
+}
+
+// GetCrossTab handles requests for the answers to a poll question broken
+// down by a demographic dimension (Age, Gender, Occupation or Country).
+func (setup OrgSetup) GetCrossTab(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received GetCrossTab request")
+	queryParams := r.URL.Query()
+	chainCodeName := queryParams.Get("chaincodeid")
+	channelID := queryParams.Get("channelid")
+	pollID := queryParams.Get("pollid")
+	questionID := queryParams.Get("questionid")
+	dimension := queryParams.Get("dimension")
+	fmt.Printf("channel: %s, chaincode: %s, poll: %s, question: %s, dimension: %s\n", channelID, chainCodeName, pollID, questionID, dimension)
+	setup.evaluateJSON(w, channelID, chainCodeName, "result:GetCrossTab", pollID, questionID, dimension)
+}
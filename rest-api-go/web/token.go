@@ -0,0 +1,238 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TokenIssuer blind-signs anonymous eligibility tokens for voters on a poll's
+// eligibility list. The list maps each poll ID to the hex-encoded SHA-256
+// hashes of the credentials handed out to its voters; every credential is
+// issued at most one token per poll, recorded in the issued file so that
+// restarts do not allow a second token. Every poll has its own RSA key, so a
+// token signed for one poll cannot be spent in another: the signature is
+// blind, and the issuer cannot tell which poll a blinded token is for.
+type TokenIssuer struct {
+	keyDir          string
+	keys            map[string]*rsa.PrivateKey
+	eligibilityPath string
+	issuedPath      string
+	mutex           sync.Mutex
+}
+
+// NewTokenIssuer returns an issuer keeping the keys of its polls in keyDir,
+// which is created if it does not exist yet.
+func NewTokenIssuer(keyDir string, eligibilityPath string, issuedPath string) (*TokenIssuer, error) {
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create issuer key directory: %w", err)
+	}
+
+	return &TokenIssuer{
+		keyDir:          keyDir,
+		keys:            make(map[string]*rsa.PrivateKey),
+		eligibilityPath: eligibilityPath,
+		issuedPath:      issuedPath,
+	}, nil
+}
+
+// pollKey returns the issuer's key for the given poll, loading it from the
+// key directory or generating and saving a new one the first time. Keys are
+// only created for polls with an eligibility list. The caller must hold the
+// mutex.
+func (issuer *TokenIssuer) pollKey(pollID string) (*rsa.PrivateKey, error) {
+	if key, ok := issuer.keys[pollID]; ok {
+		return key, nil
+	}
+
+	eligible, err := readCredentialList(issuer.eligibilityPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(eligible[pollID]) == 0 {
+		return nil, fmt.Errorf("poll %q has no eligibility list", pollID)
+	}
+
+	// the poll ID is hex-encoded so it is always a safe file name
+	keyPath := filepath.Join(issuer.keyDir, hex.EncodeToString([]byte(pollID))+".pem")
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		key, err := rsa.GenerateKey(rand.Reader, 3072)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate issuer key: %w", err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+			return nil, fmt.Errorf("failed to save issuer key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read issuer key: %w", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("issuer key %s is not PEM-encoded", keyPath)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuer key: %w", err)
+	}
+
+	issuer.keys[pollID] = key
+	return key, nil
+}
+
+// publicKeyPEM returns the PEM-encoded public key of the given poll, as
+// expected by the chaincode's SetTokenIssuerKey.
+func (issuer *TokenIssuer) publicKeyPEM(pollID string) ([]byte, error) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+
+	key, err := issuer.pollKey(pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// issue blind-signs the given value with the poll's key for the voter holding
+// credential, after checking they are eligible for the poll and have not been
+// issued a token yet.
+func (issuer *TokenIssuer) issue(pollID string, credential string, blinded *big.Int) (*big.Int, error) {
+	hash := sha256.Sum256([]byte(credential))
+	credentialHash := hex.EncodeToString(hash[:])
+
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+
+	eligible, err := readCredentialList(issuer.eligibilityPath)
+	if err != nil {
+		return nil, err
+	}
+	if !containsCredential(eligible[pollID], credentialHash) {
+		return nil, fmt.Errorf("the credential is not eligible for poll %s", pollID)
+	}
+
+	key, err := issuer.pollKey(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if blinded.Sign() <= 0 || blinded.Cmp(key.N) >= 0 {
+		return nil, fmt.Errorf("the blinded token is out of range")
+	}
+
+	issued, err := readCredentialList(issuer.issuedPath)
+	if err != nil {
+		return nil, err
+	}
+	if containsCredential(issued[pollID], credentialHash) {
+		return nil, fmt.Errorf("a token has already been issued for this credential in poll %s", pollID)
+	}
+
+	issued[pollID] = append(issued[pollID], credentialHash)
+	issuedJSON, err := json.MarshalIndent(issued, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(issuer.issuedPath, issuedJSON, 0600); err != nil {
+		return nil, fmt.Errorf("failed to record issued token: %w", err)
+	}
+
+	return new(big.Int).Exp(blinded, key.D, key.N), nil
+}
+
+// readCredentialList reads a JSON file mapping poll IDs to credential
+// hashes. A missing file is an empty list.
+func readCredentialList(path string) (map[string][]string, error) {
+	list := make(map[string][]string)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return list, nil
+}
+
+func containsCredential(hashes []string, hash string) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// IssueToken handles requests for a blind signature over a voter's token.
+// The voter sends the poll ID, their credential and the hex-encoded blinded
+// full-domain hash of their token serial under the poll's key, and unblinds
+// the returned signature before casting an anonymous ballot.
+func (setup OrgSetup) IssueToken(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received IssueToken request")
+	if setup.Issuer == nil {
+		http.Error(w, "No token issuer is configured", http.StatusServiceUnavailable)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("ParseForm() err: %s", err), http.StatusBadRequest)
+		return
+	}
+	pollID := r.FormValue("pollid")
+	blinded, ok := new(big.Int).SetString(r.FormValue("blinded"), 16)
+	if !ok {
+		http.Error(w, "The blinded token must be hex-encoded", http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("poll: %s\n", pollID)
+	signature, err := setup.Issuer.issue(pollID, r.FormValue("credential"), blinded)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error: %s", err), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"BlindSignature": hex.EncodeToString(signature.Bytes())})
+}
+
+// TokenIssuerKey handles requests for the token issuer's public key of the
+// poll given by the "pollid" query parameter. The researcher commits it to
+// the poll with SetTokenIssuerKey, and voters blind their tokens with it.
+func (setup OrgSetup) TokenIssuerKey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received TokenIssuerKey request")
+	if setup.Issuer == nil {
+		http.Error(w, "No token issuer is configured", http.StatusServiceUnavailable)
+		return
+	}
+	pollID := r.URL.Query().Get("pollid")
+	if pollID == "" {
+		http.Error(w, "The pollid parameter is required", http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("poll: %s\n", pollID)
+	publicKeyPEM, err := setup.Issuer.publicKeyPEM(pollID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error: %s", err), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(publicKeyPEM)
+}
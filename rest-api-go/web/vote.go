@@ -0,0 +1,72 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// receipt mirrors the chaincode's vote receipt.
+type receipt struct {
+	TxID        string `json:"TxID"`
+	PollID      string `json:"PollID"`
+	Commitment  string `json:"Commitment"`
+	BlockNumber uint64 `json:"BlockNumber,omitempty"`
+}
+
+// CastVote handles anonymous ballot submissions. The ballot, the voter's nonce
+// and the anonymous eligibility token obtained from /token are sent as
+// transient data, and the returned receipt is completed with the number of
+// the block the vote was committed in. Ballots are cast with
+// CastAnonymousVote under the gateway's own identity, which the chaincode
+// does not treat as the voter. Polls that identify their voters by
+// certificate cannot be voted in here, since every ballot would be signed by
+// the same identity; voters submit vote:CastVote with their own identity
+// instead, e.g. through their own gateway client.
+func (setup *OrgSetup) CastVote(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Received CastVote request")
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("ParseForm() err: %s", err), http.StatusBadRequest)
+		return
+	}
+	chainCodeName := r.FormValue("chaincodeid")
+	channelID := r.FormValue("channelid")
+	pollID := r.FormValue("pollid")
+	token := r.FormValue("token")
+	if token == "" {
+		http.Error(w, "An anonymous eligibility token is required, identified ballots must be submitted with the voter's own identity", http.StatusBadRequest)
+		return
+	}
+	transient := map[string][]byte{
+		"ballot": []byte(r.FormValue("ballot")),
+		"nonce":  []byte(r.FormValue("nonce")),
+		"token":  []byte(token),
+	}
+	fmt.Printf("channel: %s, chaincode: %s, poll: %s\n", channelID, chainCodeName, pollID)
+	network := setup.Gateway.GetNetwork(channelID)
+	contract := network.GetContract(chainCodeName)
+	result, commit, err := contract.SubmitAsync("vote:CastAnonymousVote", client.WithArguments(pollID), client.WithTransient(transient))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error submitting transaction: %s", err), http.StatusBadGateway)
+		return
+	}
+	status, err := commit.Status()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting commit status: %s", err), http.StatusBadGateway)
+		return
+	}
+	if !status.Successful {
+		http.Error(w, fmt.Sprintf("Transaction %s failed to commit with status code %d", status.TransactionID, int32(status.Code)), http.StatusBadGateway)
+		return
+	}
+	var voteReceipt receipt
+	if err := json.Unmarshal(result, &voteReceipt); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing receipt: %s", err), http.StatusBadGateway)
+		return
+	}
+	voteReceipt.BlockNumber = status.BlockNumber
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(voteReceipt)
+}
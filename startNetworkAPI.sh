@@ -4,8 +4,8 @@ starttime=$(date +%s)
 # launch network; create channel and join peer to channel
 pushd bc-network
 ./network.sh down
-./network.sh up createChannel -c mychannel -ca
-./network.sh deployCC -ccn basic -ccp ../chaincode-go/ -ccl go
+./network.sh up createChannel -c mychannel -ca -s couchdb
+./network.sh deployCC -ccn basic -ccp ../chaincode-go/ -ccl go -cccg ../chaincode-go/collections_config.json
 popd
 
 # run gateway 